@@ -15,28 +15,179 @@ type Proxy struct {
 	Protocol string `json:"protocol"`
 	Port     int    `json:"port"`
 	Address  string `json:"address"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ProxyPool sets how requests are spread over Configuration.Proxies: Rotation is
+// roundRobin or host (sticky per host). A proxy is evicted after MaxFailures
+// consecutive failures, every CheckInterval seconds each proxy fetches CheckURL
+// to be evicted or brought back, if CheckURL is empty no health check is done and
+// evicted proxies are brought back after CheckInterval seconds
+type ProxyPool struct {
+	Rotation      string `json:"rotation"`
+	CheckURL      string `json:"checkURL"`
+	CheckInterval int    `json:"checkInterval"`
+	MaxFailures   int    `json:"maxFailures"`
+}
+
+// ProxyRule routes the requests matching every condition given, Host (a leading
+// "*." matches subdomains), CIDR (against the resolved addresses) and Regex (against
+// the full URL), directly if Proxy is "direct" or through the Proxy URL otherwise
+type ProxyRule struct {
+	Host  string `json:"host"`
+	CIDR  string `json:"cidr"`
+	Regex string `json:"regex"`
+	Proxy string `json:"proxy"`
+}
+
+// Extract is a rule applied to the elements of webpages matching the CSS Selector,
+// the value of their Attr attribute, or their text if Attr is empty, is followed
+// as a webpage, downloaded as a file or captured under Name depending on Purpose
+type Extract struct {
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+	Attr     string `json:"attr"`
+	Purpose  string `json:"purpose"`
+}
+
+// Filter is an allow or deny rule matching URLs by regex or glob, against
+// the full URL or its path only, for pages to follow, assets to download or both
+type Filter struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Regex  string `json:"regex"`
+	Glob   string `json:"glob"`
+	Path   bool   `json:"path"`
+}
+
+// Auth adds credentials and header fields to the requests sent to Host, a leading
+// "*." matches subdomains, or to URLs matching the Pattern regex. Type is basic,
+// bearer or empty for header fields only, any value may be given as env:NAME or
+// file:PATH to be read from an environment variable or a file
+type Auth struct {
+	Host     string            `json:"host"`
+	Pattern  string            `json:"pattern"`
+	Type     string            `json:"type"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	Token    string            `json:"token"`
+	Headers  map[string]string `json:"headers"`
+}
+
+// Login describes a form login performed before crawling. The token of the
+// element matching CSRFSelector is posted along with Fields to Action, the login
+// succeeds if the response matches every Success condition given. Any response
+// matching a LoggedOut condition during the crawl triggers a new login, values
+// of Fields may be given as env:NAME or file:PATH like in Auth
+type Login struct {
+	URL               string            `json:"url"`
+	Action            string            `json:"action"`
+	CSRFSelector      string            `json:"csrfSelector"`
+	CSRFField         string            `json:"csrfField"`
+	Fields            map[string]string `json:"fields"`
+	SuccessStatus     int               `json:"successStatus"`
+	SuccessRedirect   string            `json:"successRedirect"`
+	SuccessText       string            `json:"successText"`
+	LoggedOutStatus   int               `json:"loggedOutStatus"`
+	LoggedOutRedirect string            `json:"loggedOutRedirect"`
+	LoggedOutText     string            `json:"loggedOutText"`
+}
+
+// Profile is a named set of header fields sent with requests, Headers holds
+// any other field such as the sec-ch-ua client hints
+type Profile struct {
+	Name           string            `json:"name"`
+	UserAgent      string            `json:"userAgent"`
+	Accept         string            `json:"accept"`
+	AcceptLanguage string            `json:"acceptLanguage"`
+	Headers        map[string]string `json:"headers"`
+}
+
+// ClientCert is a client certificate presented to Host, a leading "*." matches subdomains
+type ClientCert struct {
+	Host     string `json:"host"`
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// TLS adds CA bundles to the system roots, sets client certificates, the
+// minimum TLS version (1.0 to 1.3) and disables verification if Insecure is set
+type TLS struct {
+	CAFiles     []string     `json:"caFiles"`
+	ClientCerts []ClientCert `json:"clientCerts"`
+	MinVersion  string       `json:"minVersion"`
+	Insecure    bool         `json:"insecure"`
 }
 
 type Option struct {
-	Depth            int  `json:"depth"`
-	MaxConcurrency   int  `json:"maxConcurrency"`
-	ExternalWebpages bool `json:"externelWebpages"`
+	Depth              int      `json:"depth"`
+	MaxConcurrency     int      `json:"maxConcurrency"`
+	ExternalWebpages   bool     `json:"externelWebpages"`
+	Resume             bool     `json:"resume"`
+	CheckpointInterval int      `json:"checkpointInterval"`
+	HostRate           float64  `json:"hostRate"`
+	HostDelay          int      `json:"hostDelay"`
+	HostMaxConcurrency int      `json:"hostMaxConcurrency"`
+	IgnoreRobots       bool     `json:"ignoreRobots"`
+	Sitemaps           bool     `json:"sitemaps"`
+	SitemapSince       string   `json:"sitemapSince"`
+	Order              string   `json:"order"`
+	GracePeriod        int      `json:"gracePeriod"`
+	Retries            int      `json:"retries"`
+	RetryBackoff       int      `json:"retryBackoff"`
+	Scope              string   `json:"scope"`
+	AllowedHosts       []string `json:"allowedHosts"`
+	MaxFileSize        int64    `json:"maxFileSize"`
+	Segments           int      `json:"segments"`
+	SegmentThreshold   int64    `json:"segmentThreshold"`
+
+	ConnectTimeout        int   `json:"connectTimeout"`
+	TLSHandshakeTimeout   int   `json:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout int   `json:"responseHeaderTimeout"`
+	IdleTimeout           int   `json:"idleTimeout"`
+	Timeout               int   `json:"timeout"`
+	MaxRedirects          int   `json:"maxRedirects"`
+	MaxBodySize           int64 `json:"maxBodySize"`
+
+	Redirects string `json:"redirects"`
+	Srcset    string `json:"srcset"`
 }
 
 type Configuration struct {
-	Log           string   `json:"log"`
-	Dir           string   `json:"dir"`
-	FileTypes     []string `json:"fileTypes"`
-	Proxy         *Proxy   `json:"proxy"`
-	Option        *Option  `json:"option"`
-	Headless      Headless `json:"headless"`
-	UserAgent     string   `json:"userAgent"`
-	DisableCookie bool     `json:"enableCookie"`
+	Log           string    `json:"log"`
+	Dir           string    `json:"dir"`
+	FileTypes     []string  `json:"fileTypes"`
+	Proxy         *Proxy    `json:"proxy"`
+	Option        *Option   `json:"option"`
+	Headless      Headless  `json:"headless"`
+	UserAgent     string    `json:"userAgent"`
+	DisableCookie bool      `json:"enableCookie"`
+	StripParams   []string  `json:"stripParams"`
+	Filters       []Filter  `json:"filters"`
+	Auth          []Auth    `json:"auth"`
+	Login         *Login    `json:"login"`
+	CookiesIn     string    `json:"cookiesIn"`
+	CookiesOut    string    `json:"cookiesOut"`
+	Profiles      []Profile `json:"profiles"`
+	Rotation      string    `json:"rotation"`
+	TLS           *TLS      `json:"tls"`
+	Proxies       []Proxy   `json:"proxies"`
+	ProxyPool     ProxyPool `json:"proxyPool"`
+
+	ProxyRules []ProxyRule `json:"proxyRules"`
+	PAC        string      `json:"pac"`
+	Extract    []Extract   `json:"extract"`
 }
 
 func (p *Proxy) URL() *url.URL {
-	return &url.URL{
+	u := &url.URL{
 		Scheme: p.Protocol,
 		Host:   net.JoinHostPort(p.Address, strconv.FormatInt(int64(p.Port), 10)),
 	}
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	return u
 }
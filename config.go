@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"flag"
 	"io/ioutil"
 	"net/url"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/NzKSO/murphy/conf"
+	"github.com/NzKSO/murphy/crawl"
 )
 
 func readConfigFile(path string) (*conf.Configuration, error) {
@@ -30,6 +32,64 @@ func readConfigFile(path string) (*conf.Configuration, error) {
 	if config.Option.MaxConcurrency < 0 {
 		return nil, errors.New("invalid max concurrency")
 	}
+
+	if config.Option.CheckpointInterval < 0 {
+		return nil, errors.New("invalid checkpoint interval")
+	}
+
+	if config.Option.HostRate < 0 || config.Option.HostDelay < 0 || config.Option.HostMaxConcurrency < 0 {
+		return nil, errors.New("invalid per-host limit")
+	}
+
+	if config.Option.GracePeriod < 0 {
+		return nil, errors.New("invalid grace period")
+	}
+
+	if config.Option.Retries < 0 || config.Option.RetryBackoff < 0 {
+		return nil, errors.New("invalid retry option")
+	}
+
+	if !crawl.ValidOrder(config.Option.Order) {
+		return nil, errors.New("invalid crawl order")
+	}
+
+	if !crawl.ValidScope(config.Option.Scope) {
+		return nil, errors.New("invalid crawl scope")
+	}
+
+	if config.Option.MaxFileSize < 0 {
+		return nil, errors.New("invalid max file size")
+	}
+
+	if config.Option.ConnectTimeout < 0 || config.Option.TLSHandshakeTimeout < 0 ||
+		config.Option.ResponseHeaderTimeout < 0 || config.Option.IdleTimeout < 0 ||
+		config.Option.Timeout < 0 || config.Option.MaxRedirects < 0 || config.Option.MaxBodySize < 0 {
+		return nil, errors.New("invalid timeout or response limit")
+	}
+
+	if !crawl.ValidRedirectPolicy(config.Option.Redirects) {
+		return nil, errors.New("invalid redirect policy")
+	}
+
+	if !crawl.ValidSrcset(config.Option.Srcset) {
+		return nil, errors.New("invalid srcset selection")
+	}
+
+	if !crawl.ValidProxyRotation(config.ProxyPool.Rotation) {
+		return nil, errors.New("invalid proxy rotation")
+	}
+
+	if config.TLS != nil && !crawl.ValidTLSVersion(config.TLS.MinVersion) {
+		return nil, errors.New("invalid minimum TLS version")
+	}
+
+	if !crawl.ValidRotation(config.Rotation) {
+		return nil, errors.New("invalid profile rotation")
+	}
+
+	if config.Option.Segments < 0 || config.Option.SegmentThreshold < 0 {
+		return nil, errors.New("invalid segmented download setting")
+	}
 	return &config, err
 }
 
@@ -50,7 +110,7 @@ func overrideConfig(config *conf.Configuration) error {
 		}
 		if idx := strings.IndexByte(xFlag, '='); idx > 0 {
 			xFlag = xFlag[:idx]
-		} else if xFlag != "external" && xFlag != "headless" {
+		} else if !isBoolFlag(xFlag) {
 			i++
 		}
 		switch xFlag {
@@ -66,9 +126,16 @@ func overrideConfig(config *conf.Configuration) error {
 			if config.Proxy == nil {
 				config.Proxy = new(conf.Proxy)
 			}
+			if !crawl.ValidProxyProtocol(u.Scheme) {
+				return errors.New("Flag proxy: " + unsupportProxy)
+			}
 			config.Proxy.Address = u.Hostname()
 			config.Proxy.Port = port
 			config.Proxy.Protocol = u.Scheme
+			config.Proxy.Username = u.User.Username()
+			config.Proxy.Password, _ = u.User.Password()
+		case "pac":
+			config.PAC = pacFile
 		case "depth":
 			if depth < -1 {
 				return errors.New("Flag depth: " + invalidDepth)
@@ -90,12 +157,159 @@ func overrideConfig(config *conf.Configuration) error {
 			config.Dir = prefix
 		case "log":
 			config.Log = logFile
+		case "cookies-in":
+			config.CookiesIn = cookiesIn
+		case "cookies-out":
+			config.CookiesOut = cookiesOut
+		case "connectTimeout":
+			if connectTO < 0 {
+				return errors.New("Flag connectTimeout: " + invalidLimit)
+			}
+			config.Option.ConnectTimeout = connectTO
+		case "tlsHandshakeTimeout":
+			if tlsTO < 0 {
+				return errors.New("Flag tlsHandshakeTimeout: " + invalidLimit)
+			}
+			config.Option.TLSHandshakeTimeout = tlsTO
+		case "responseHeaderTimeout":
+			if headerTO < 0 {
+				return errors.New("Flag responseHeaderTimeout: " + invalidLimit)
+			}
+			config.Option.ResponseHeaderTimeout = headerTO
+		case "idleTimeout":
+			if idleTO < 0 {
+				return errors.New("Flag idleTimeout: " + invalidLimit)
+			}
+			config.Option.IdleTimeout = idleTO
+		case "timeout":
+			if timeout < 0 {
+				return errors.New("Flag timeout: " + invalidLimit)
+			}
+			config.Option.Timeout = timeout
+		case "maxRedirects":
+			if maxRedirects < 0 {
+				return errors.New("Flag maxRedirects: " + invalidLimit)
+			}
+			config.Option.MaxRedirects = maxRedirects
+		case "redirects":
+			if !crawl.ValidRedirectPolicy(redirects) {
+				return errors.New("Flag redirects: " + invalidRedirect)
+			}
+			config.Option.Redirects = redirects
+		case "srcset":
+			if !crawl.ValidSrcset(srcset) {
+				return errors.New("Flag srcset: " + invalidSrcset)
+			}
+			config.Option.Srcset = srcset
+		case "maxBodySize":
+			if maxBodySize < 0 {
+				return errors.New("Flag maxBodySize: " + invalidLimit)
+			}
+			config.Option.MaxBodySize = maxBodySize
+		case "caFile":
+			tlsConfig(config).CAFiles = []string(caFiles)
+		case "tlsMinVersion":
+			if !crawl.ValidTLSVersion(tlsMinVersion) {
+				return errors.New("Flag tlsMinVersion: " + invalidTLSVersion)
+			}
+			tlsConfig(config).MinVersion = tlsMinVersion
+		case "insecure":
+			tlsConfig(config).Insecure = insecure
+		case "rotation":
+			if !crawl.ValidRotation(rotation) {
+				return errors.New("Flag rotation: " + invalidRotation)
+			}
+			config.Rotation = rotation
+		case "resume":
+			config.Option.Resume = resume
+		case "hostRate":
+			if hostRate < 0 {
+				return errors.New("Flag hostRate: " + invalidHostLimit)
+			}
+			config.Option.HostRate = hostRate
+		case "hostDelay":
+			if hostDelay < 0 {
+				return errors.New("Flag hostDelay: " + invalidHostLimit)
+			}
+			config.Option.HostDelay = hostDelay
+		case "hostMaxCon":
+			if hostMaxCon < 0 {
+				return errors.New("Flag hostMaxCon: " + invalidHostLimit)
+			}
+			config.Option.HostMaxConcurrency = hostMaxCon
+		case "ignoreRobots":
+			config.Option.IgnoreRobots = ignoreRobots
+		case "sitemaps":
+			config.Option.Sitemaps = sitemaps
+		case "order":
+			if !crawl.ValidOrder(order) {
+				return errors.New("Flag order: " + invalidOrder)
+			}
+			config.Option.Order = order
+		case "scope":
+			if !crawl.ValidScope(scope) {
+				return errors.New("Flag scope: " + invalidScope)
+			}
+			config.Option.Scope = scope
+		case "allowHost":
+			config.Option.AllowedHosts = []string(allowedHosts)
+		case "maxFileSize":
+			if maxFileSize < 0 {
+				return errors.New("Flag maxFileSize: " + invalidMaxFileSize)
+			}
+			config.Option.MaxFileSize = maxFileSize
+		case "segments":
+			if segments < 0 {
+				return errors.New("Flag segments: " + invalidSegments)
+			}
+			config.Option.Segments = segments
+		case "segmentThreshold":
+			if segThreshold < 0 {
+				return errors.New("Flag segmentThreshold: " + invalidSegments)
+			}
+			config.Option.SegmentThreshold = segThreshold
+		case "grace":
+			if grace < 0 {
+				return errors.New("Flag grace: " + invalidGrace)
+			}
+			config.Option.GracePeriod = grace
+		case "retries":
+			if retries < 0 {
+				return errors.New("Flag retries: " + invalidRetry)
+			}
+			config.Option.Retries = retries
+		case "retryBackoff":
+			if retryBackoff < 0 {
+				return errors.New("Flag retryBackoff: " + invalidRetry)
+			}
+			config.Option.RetryBackoff = retryBackoff
 			// case "headless":
 			// 	config.Headless = headlessMode
 		}
 	}
+	if len(filters) > 0 {
+		config.Filters = append(filters, config.Filters...)
+	}
+
 	if len(config.FileTypes) < 1 {
 		return errors.New(emptyListSet)
 	}
 	return nil
 }
+
+func isBoolFlag(name string) bool {
+	f := flag.Lookup(name)
+	if f == nil {
+		return false
+	}
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
+}
+
+// tlsConfig returns the TLS configuration of config, creating it if needed
+func tlsConfig(config *conf.Configuration) *conf.TLS {
+	if config.TLS == nil {
+		config.TLS = &conf.TLS{}
+	}
+	return config.TLS
+}
@@ -1,5 +1,10 @@
 package main
 
+const (
+	defaultCheckpointInterval = 30
+	defaultGracePeriod        = 30
+)
+
 const (
 	versionInfo    = "v0.9.0 beta"
 	proxyUsage     = "Specify proxy address, currenctly support http(s) and socks5 proxy only"
@@ -13,6 +18,7 @@ const (
 	headlessUsage  = "Enable headless mode, require Chrome browser 59+ to be installed on your system"
 	logUsage       = "Path to the log file"
 	cookieUsage    = "Disable Cookie support"
+	resumeUsage    = "Resume the previous crawl from the checkpoint kept in the output directory"
 	emptyListSet   = "File types can't be empty set! please use -ftypes to set or specify in configuration file and try again"
 	invalidDepth   = "Invalid value, please provide an integer value greater than -2 and try again"
 	invalidMaxCon  = "Invalid value, please provide an integer value greater than or equal to 0 and try again"
@@ -21,3 +27,95 @@ const (
 	unsupportProxy = "Unsupported proxy type, currenctly support http(s) and socks5 proxy only"
 	notice         = "If flag valus provided, the corresponding settings in config file will be override"
 )
+
+const (
+	hostRateUsage    = "The maximum number of requests per second sent to a single host. 0 means no limit (default 0)"
+	hostDelayUsage   = "The minimum delay in milliseconds between two requests to a single host (default 0)"
+	hostMaxConUsage  = "The maximum number of concurrent requests to a single host. 0 means no limit (default 0)"
+	invalidHostLimit = "Invalid value, please provide a number greater than or equal to 0 and try again"
+)
+
+const (
+	ignoreRobotsUsage = "Ignore robots.txt, only use it for sites you own (default false)"
+	sitemapsUsage     = "Seed the crawl with the URLs listed in the sitemaps of each url passed as command-line arg (default false)"
+)
+
+const (
+	orderUsage   = "The order in which webpages are crawled: bfs, dfs or priority (default bfs)"
+	invalidOrder = "Invalid value, please provide one of bfs, dfs or priority and try again"
+)
+
+const (
+	graceUsage   = "The number of seconds to wait for in-flight downloads on shutdown before aborting them (default 30)"
+	invalidGrace = "Invalid value, please provide an integer value greater than or equal to 0 and try again"
+)
+
+const (
+	retriesUsage      = "The maximum number of retries per URL on network errors, 5xx, 408 and 429 responses (default 0)"
+	retryBackoffUsage = "The base delay in milliseconds of the exponential backoff between retries (default 500)"
+	invalidRetry      = "Invalid value, please provide an integer value greater than or equal to 0 and try again"
+)
+
+const (
+	allowUsage      = "Follow only webpages matching the rule, repeatable and evaluated in order before the rules in config file. A rule is a regex on the full URL, or prefixed by glob:, path: (regex on path) or pathGlob:"
+	denyUsage       = "Don't follow webpages matching the rule, repeatable, see -allow for the rule syntax"
+	allowAssetUsage = "Download only files matching the rule, repeatable, see -allow for the rule syntax"
+	denyAssetUsage  = "Don't download files matching the rule, repeatable, see -allow for the rule syntax"
+)
+
+const (
+	scopeUsage     = "The webpages to follow relative to each url passed as command-line arg: host, domain (registrable domain), subdomains, prefix (path prefix), allowlist (hosts given by -allowHost) or any (default host, any if -external is set)"
+	allowHostUsage = "Comma-separated list of hosts to follow in allowlist scope, a leading *. matches subdomains, repeatable"
+	invalidScope   = "Invalid value, please provide one of host, domain, subdomains, prefix, allowlist or any and try again"
+)
+
+const (
+	maxFileSizeUsage   = "The maximum size in bytes of a downloaded file, larger transfers are aborted. 0 means no limit (default 0)"
+	invalidMaxFileSize = "Invalid value, please provide an integer value greater than or equal to 0 and try again"
+)
+
+const (
+	segmentsUsage         = "The number of parallel range requests used to download a large file when the server supports it. 0 or 1 disables segmented downloads (default 0)"
+	segmentThresholdUsage = "The minimum size in bytes of a file downloaded in segments (default 67108864)"
+	invalidSegments       = "Invalid value, please provide an integer value greater than or equal to 0 and try again"
+)
+
+const (
+	cookiesInUsage  = "Load cookies from a Netscape cookies.txt or JSON file before crawling"
+	cookiesOutUsage = "Save cookies to a file after crawling, in JSON if the file name ends with .json and in Netscape cookies.txt format otherwise"
+)
+
+const (
+	rotationUsage   = "How header profiles of the config file rotate: request (every request), host (sticky per host) or session (one per run) (default session)"
+	invalidRotation = "Invalid value, please provide one of request, host or session and try again"
+)
+
+const (
+	connectTimeoutUsage        = "Timeout in seconds for establishing a connection (default 30)"
+	tlsHandshakeTimeoutUsage   = "Timeout in seconds for the TLS handshake (default 10)"
+	responseHeaderTimeoutUsage = "Timeout in seconds waiting for the response header after sending a request (default 30)"
+	idleTimeoutUsage           = "Time in seconds an idle keep-alive connection is kept open (default 90)"
+	timeoutUsage               = "Timeout in seconds for a whole request including reading the response body. 0 means no limit (default 0)"
+	maxRedirectsUsage          = "The maximum number of redirects followed by a request (default 10)"
+	maxBodySizeUsage           = "The maximum size in bytes of any response body, larger responses are aborted. 0 means no limit (default 0)"
+	invalidLimit               = "Invalid value, please provide an integer value greater than or equal to 0 and try again"
+)
+
+const (
+	caFileUsage        = "A PEM bundle of CA certificates trusted in addition to the system roots, repeatable"
+	tlsMinVersionUsage = "The minimum TLS version: 1.0, 1.1, 1.2 or 1.3 (default 1.2)"
+	insecureUsage      = "Don't verify TLS certificates, connections can be intercepted"
+	invalidTLSVersion  = "Invalid value, please provide one of 1.0, 1.1, 1.2 or 1.3 and try again"
+)
+
+const pacUsage = "Path to a proxy auto-config file picking the proxy of requests not matched by the proxy rules of the config file"
+
+const (
+	redirectsUsage  = "Where redirects may lead: any, scope (webpages and files stay in the crawl scope) or assets (only files may leave the crawl scope) (default assets)"
+	invalidRedirect = "Invalid value, please provide one of any, scope or assets and try again"
+)
+
+const (
+	srcsetUsage   = "The images of srcset attributes to download: largest (the widest or densest candidate) or all (default largest)"
+	invalidSrcset = "Invalid value, please provide one of largest or all and try again"
+)
@@ -0,0 +1,137 @@
+package crawl
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/NzKSO/murphy/conf"
+)
+
+// Authentication types
+const (
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+)
+
+type authRule struct {
+	host   string
+	re     *regexp.Regexp
+	header http.Header
+}
+
+// resolveSecret returns the value referenced by an env:NAME or file:PATH value,
+// any other value is returned as is
+func resolveSecret(val string) (string, error) {
+	switch {
+	case strings.HasPrefix(val, "env:"):
+		name := val[len("env:"):]
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.New("environment variable not set: " + name)
+		}
+		return secret, nil
+	case strings.HasPrefix(val, "file:"):
+		data, err := ioutil.ReadFile(val[len("file:"):])
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return val, nil
+	}
+}
+
+func compileAuth(auths []conf.Auth) ([]*authRule, error) {
+	rules := make([]*authRule, 0, len(auths))
+	for _, auth := range auths {
+		if auth.Host == "" && auth.Pattern == "" {
+			return nil, errors.New("auth requires a host or pattern")
+		}
+
+		rule := &authRule{host: auth.Host, header: make(http.Header)}
+		if auth.Pattern != "" {
+			re, err := regexp.Compile(auth.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			rule.re = re
+		}
+
+		for key, val := range auth.Headers {
+			secret, err := resolveSecret(val)
+			if err != nil {
+				return nil, err
+			}
+			rule.header.Set(key, secret)
+		}
+
+		switch strings.ToLower(auth.Type) {
+		case "":
+		case AuthBasic:
+			username, err := resolveSecret(auth.Username)
+			if err != nil {
+				return nil, err
+			}
+			password, err := resolveSecret(auth.Password)
+			if err != nil {
+				return nil, err
+			}
+			credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+			rule.header.Set("Authorization", "Basic "+credentials)
+		case AuthBearer:
+			token, err := resolveSecret(auth.Token)
+			if err != nil {
+				return nil, err
+			}
+			rule.header.Set("Authorization", "Bearer "+token)
+		default:
+			return nil, errors.New("invalid auth type: " + auth.Type)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// SetAuth sets the credentials and header fields added to requests, secrets are resolved once here
+func (crawler *Crawler) SetAuth(auths []conf.Auth) error {
+	rules, err := compileAuth(auths)
+	if err != nil {
+		return err
+	}
+	crawler.auth = rules
+	return nil
+}
+
+// authorize adds the header fields of the first auth rule matching the URL of req
+func (crawler *Crawler) authorize(req *http.Request) {
+	host := strings.ToLower(req.URL.Hostname())
+	for _, rule := range crawler.auth {
+		if rule.host != "" && !matchHost(host, rule.host) {
+			continue
+		}
+		if rule.re != nil && !rule.re.MatchString(req.URL.String()) {
+			continue
+		}
+
+		for key, vals := range rule.header {
+			req.Header[key] = vals
+		}
+		return
+	}
+}
+
+// reauthorize replaces the auth header fields copied from the previous request
+// of a redirect with those of the rule matching the new URL, if any
+func (crawler *Crawler) reauthorize(req *http.Request) {
+	for _, rule := range crawler.auth {
+		for key := range rule.header {
+			req.Header.Del(key)
+		}
+	}
+	crawler.authorize(req)
+}
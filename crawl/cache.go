@@ -0,0 +1,211 @@
+package crawl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	cacheFileName = "cache.json"
+	cachePagesDir = "pages"
+)
+
+type cacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Hash         string `json:"hash,omitempty"`
+	File         string `json:"file,omitempty"`
+}
+
+// Cache keeps the validators of the responses of previous runs so that unchanged
+// webpages and files can be detected with conditional requests, a copy of each
+// webpage is kept under its content hash to be parsed again on 304 Not Modified
+type Cache struct {
+	mu      sync.Mutex
+	dir     string
+	entries map[string]*cacheEntry
+}
+
+// OpenCache opens the cache kept in output directory dir
+func OpenCache(dir string) (*Cache, error) {
+	c := &Cache{
+		dir:     StateDir(dir),
+		entries: make(map[string]*cacheEntry),
+	}
+
+	if err := os.MkdirAll(filepath.Join(c.dir, cachePagesDir), 0755); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, cacheFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &c.entries); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cache) pagePath(hash string) string {
+	return filepath.Join(c.dir, cachePagesDir, hash+".html")
+}
+
+// lookup returns the entry of rawurl if its local copy still exists
+func (c *Cache) lookup(rawurl string) *cacheEntry {
+	c.mu.Lock()
+	entry, ok := c.entries[rawurl]
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	path := entry.File
+	if entry.Hash != "" {
+		path = c.pagePath(entry.Hash)
+	}
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	return entry
+}
+
+// conditional makes req conditional on the validators cached for its URL and
+// returns the matching entry, nil is returned if nothing usable is cached
+func (c *Cache) conditional(req *http.Request) *cacheEntry {
+	entry := c.lookup(req.URL.String())
+	if entry == nil {
+		return nil
+	}
+
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+	return entry
+}
+
+func newCacheEntry(header http.Header) *cacheEntry {
+	if header.Get("ETag") == "" && header.Get("Last-Modified") == "" {
+		return nil
+	}
+	return &cacheEntry{
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+	}
+}
+
+// storeFile records that the response for rawurl was written to path
+func (c *Cache) storeFile(rawurl string, header http.Header, path string) {
+	entry := newCacheEntry(header)
+	if entry == nil {
+		return
+	}
+	entry.File = path
+
+	c.mu.Lock()
+	c.entries[rawurl] = entry
+	c.mu.Unlock()
+}
+
+// storePage keeps a copy of webpage content for rawurl
+func (c *Cache) storePage(rawurl string, header http.Header, content []byte) error {
+	entry := newCacheEntry(header)
+	if entry == nil {
+		return nil
+	}
+	sum := sha256.Sum256(content)
+	entry.Hash = hex.EncodeToString(sum[:])
+
+	// the lock keeps Save from pruning the copy before its entry is recorded
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := c.pagePath(entry.Hash)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		tmp, err := ioutil.TempFile(filepath.Dir(path), "."+entry.Hash+".*.tmp")
+		if err != nil {
+			return err
+		}
+		if _, err = tmp.Write(content); err == nil {
+			err = tmp.Close()
+		} else {
+			tmp.Close()
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+
+	c.entries[rawurl] = entry
+	return nil
+}
+
+// page returns the local copy of the webpage of entry
+func (c *Cache) page(entry *cacheEntry) ([]byte, error) {
+	return ioutil.ReadFile(c.pagePath(entry.Hash))
+}
+
+// Save writes the cache to disk and removes webpage copies no longer referenced
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(c.dir, cacheFileName+".")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, cacheFileName))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	referenced := make(map[string]bool)
+	for _, entry := range c.entries {
+		if entry.Hash != "" {
+			referenced[filepath.Base(c.pagePath(entry.Hash))] = true
+		}
+	}
+	files, err := ioutil.ReadDir(filepath.Join(c.dir, cachePagesDir))
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if !referenced[fi.Name()] && filepath.Ext(fi.Name()) == ".html" {
+			os.Remove(filepath.Join(c.dir, cachePagesDir, fi.Name()))
+		}
+	}
+	return nil
+}
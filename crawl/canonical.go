@@ -0,0 +1,167 @@
+package crawl
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicalURL returns a normalized copy of u used for deduplication: lowercase
+// scheme and host, no default port, no fragment, normalized percent-encoding and
+// dot segments, and sorted query parameters without those matching strip
+func canonicalURL(u *url.URL, strip []string) *url.URL {
+	cu := *u
+	cu.User = nil
+	cu.Fragment = ""
+	cu.RawFragment = ""
+	cu.Scheme = strings.ToLower(cu.Scheme)
+
+	host := strings.ToLower(cu.Hostname())
+	if strings.IndexByte(host, ':') != -1 {
+		host = "[" + host + "]"
+	}
+	if port := cu.Port(); port != "" && port != defaultPorts[cu.Scheme] {
+		host += ":" + port
+	}
+	cu.Host = host
+
+	escaped := removeDotSegments(normalizePercentEncoding(cu.EscapedPath()))
+	if escaped == "" && cu.Host != "" {
+		escaped = "/"
+	}
+	if p, err := url.PathUnescape(escaped); err == nil {
+		cu.Path, cu.RawPath = p, escaped
+	}
+
+	cu.ForceQuery = false
+	cu.RawQuery = canonicalQuery(cu.RawQuery, strip)
+	return &cu
+}
+
+func canonicalQuery(rawQuery string, strip []string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		param = normalizePercentEncoding(param)
+		key := param
+		if idx := strings.IndexByte(param, '='); idx != -1 {
+			key = param[:idx]
+		}
+		if name, err := url.QueryUnescape(key); err == nil && matchAnyParam(name, strip) {
+			continue
+		}
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func matchAnyParam(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// normalizePercentEncoding decodes percent-encoded unreserved characters and
+// uppercases the hex digits of the remaining escapes
+func normalizePercentEncoding(s string) string {
+	if strings.IndexByte(s, '%') == -1 {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			hi, ok1 := unhex(s[i+1])
+			lo, ok2 := unhex(s[i+2])
+			if ok1 && ok2 {
+				if c := hi<<4 | lo; isUnreserved(c) {
+					sb.WriteByte(c)
+				} else {
+					sb.WriteString(strings.ToUpper(s[i : i+3]))
+				}
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// removeDotSegments implements the algorithm of RFC 3986 section 5.2.4
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+
+	// the leading empty segment of an absolute path is never removed
+	var floor int
+	if strings.HasPrefix(p, "/") {
+		floor = 1
+	}
+
+	var out []string
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		switch seg {
+		case ".":
+			if i == len(segments)-1 {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > floor {
+				out = out[:len(out)-1]
+			}
+			if i == len(segments)-1 {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// canonical returns the canonical form of u according to the configuration
+func (crawler *Crawler) canonical(u *url.URL) *url.URL {
+	return canonicalURL(u, crawler.config.StripParams)
+}
+
+// seenKey returns the key of u in crawledURL, its canonical form, u itself is
+// what gets fetched
+func (crawler *Crawler) seenKey(u *url.URL) string {
+	return crawler.canonical(u).String()
+}
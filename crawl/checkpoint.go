@@ -0,0 +1,266 @@
+package crawl
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	stateDirName   = ".murphy"
+	stateFileName  = "state.json"
+	journalName    = "journal.log"
+	opPush, opDone = "push", "done"
+)
+
+type journalRecord struct {
+	Op    string  `json:"op"`
+	URL   string  `json:"url"`
+	Seed  string  `json:"seed,omitempty"`
+	Depth int     `json:"depth,omitempty"`
+	Level int     `json:"level,omitempty"`
+	Score float64 `json:"score,omitempty"`
+}
+
+type pendingEntry struct {
+	Seed  string  `json:"seed,omitempty"`
+	Depth int     `json:"depth"`
+	Level int     `json:"level,omitempty"`
+	Score float64 `json:"score,omitempty"`
+}
+
+type checkpointState struct {
+	Seen    []string                `json:"seen"`
+	Pending map[string]pendingEntry `json:"pending"`
+}
+
+// Checkpoint persists the crawl frontier and the set of crawled URLs to disk,
+// every change is appended to a journal which is compacted into a snapshot on Save
+type Checkpoint struct {
+	mu      sync.Mutex
+	dir     string
+	journal *os.File
+	seen    map[string]bool
+	pending map[string]pendingEntry
+}
+
+// StateDir returns the directory where murphy keeps its state for output directory dir
+func StateDir(dir string) string {
+	return filepath.Join(dir, stateDirName)
+}
+
+// OpenCheckpoint opens the checkpoint kept in output directory dir,
+// previous state is loaded if resume is true and discarded otherwise
+func OpenCheckpoint(dir string, resume bool) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		dir:     StateDir(dir),
+		seen:    make(map[string]bool),
+		pending: make(map[string]pendingEntry),
+	}
+
+	if err := os.MkdirAll(cp.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	if resume {
+		if err := cp.load(); err != nil {
+			return nil, err
+		}
+	} else {
+		os.Remove(filepath.Join(cp.dir, stateFileName))
+		os.Remove(filepath.Join(cp.dir, journalName))
+	}
+
+	f, err := os.OpenFile(filepath.Join(cp.dir, journalName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cp.journal = f
+	return cp, nil
+}
+
+func (cp *Checkpoint) load() error {
+	data, err := ioutil.ReadFile(filepath.Join(cp.dir, stateFileName))
+	if err == nil {
+		var state checkpointState
+		if err = json.Unmarshal(data, &state); err != nil {
+			return err
+		}
+		for _, u := range state.Seen {
+			cp.seen[u] = true
+		}
+		for u, p := range state.Pending {
+			cp.pending[u] = p
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(cp.dir, journalName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec journalRecord
+		// the last line may be truncated if the previous run crashed
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		cp.apply(&rec)
+	}
+	return scanner.Err()
+}
+
+func (cp *Checkpoint) apply(rec *journalRecord) {
+	switch rec.Op {
+	case opPush:
+		if !cp.seen[rec.URL] {
+			cp.pending[rec.URL] = pendingEntry{rec.Seed, rec.Depth, rec.Level, rec.Score}
+		}
+	case opDone:
+		delete(cp.pending, rec.URL)
+		cp.seen[rec.URL] = true
+	}
+}
+
+func (cp *Checkpoint) record(rec *journalRecord) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.apply(rec)
+	if cp.journal == nil {
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	cp.journal.Write(append(data, '\n'))
+}
+
+// Push records urlTopo as pending
+func (cp *Checkpoint) Push(urlTopo *URLTopological) {
+	rec := &journalRecord{
+		Op:    opPush,
+		URL:   urlTopo.URL.String(),
+		Depth: urlTopo.Depth,
+		Level: urlTopo.Level,
+		Score: urlTopo.Score,
+	}
+	if urlTopo.Seed != nil {
+		rec.Seed = urlTopo.Seed.String()
+	}
+	cp.record(rec)
+}
+
+// Done records url as crawled
+func (cp *Checkpoint) Done(rawurl string) {
+	cp.record(&journalRecord{Op: opDone, URL: rawurl})
+}
+
+// Seen returns all URLs that have been crawled
+func (cp *Checkpoint) Seen() []string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	seen := make([]string, 0, len(cp.seen))
+	for u := range cp.seen {
+		seen = append(seen, u)
+	}
+	sort.Strings(seen)
+	return seen
+}
+
+// Pending returns URLs that have been discovered but not crawled yet
+func (cp *Checkpoint) Pending() []*URLTopological {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	pending := make([]*URLTopological, 0, len(cp.pending))
+	for rawurl, p := range cp.pending {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			continue
+		}
+		urlTopo := &URLTopological{URL: u, Depth: p.Depth, Level: p.Level, Score: p.Score}
+		if seed, err := url.Parse(p.Seed); err == nil && p.Seed != "" {
+			urlTopo.Seed = seed
+		}
+		pending = append(pending, urlTopo)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].URL.String() < pending[j].URL.String()
+	})
+	return pending
+}
+
+// Save writes a snapshot of the current state and truncates the journal
+func (cp *Checkpoint) Save() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	state := checkpointState{
+		Seen:    make([]string, 0, len(cp.seen)),
+		Pending: cp.pending,
+	}
+	for u := range cp.seen {
+		state.Seen = append(state.Seen, u)
+	}
+
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(cp.dir, stateFileName+".")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(cp.dir, stateFileName))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if cp.journal != nil {
+		if err = cp.journal.Truncate(0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close saves the checkpoint and closes the journal
+func (cp *Checkpoint) Close() error {
+	err := cp.Save()
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.journal != nil {
+		if cerr := cp.journal.Close(); err == nil {
+			err = cerr
+		}
+		cp.journal = nil
+	}
+	return err
+}
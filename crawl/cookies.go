@@ -0,0 +1,299 @@
+package crawl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const httpOnlyPrefix = "#HttpOnly_"
+
+var errCookiesDisabled = errors.New("cookies are disabled")
+
+// Cookie is a cookie as stored in cookies.txt and JSON cookie files
+type Cookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires"`
+	Secure   bool      `json:"secure"`
+	HTTPOnly bool      `json:"httpOnly"`
+	HostOnly bool      `json:"hostOnly"`
+}
+
+type cookieKey struct {
+	domain, path, name string
+}
+
+// recordingJar is a cookie jar which also records the attributes of the cookies
+// it accepts, since they can't be listed from a cookiejar.Jar
+type recordingJar struct {
+	http.CookieJar
+	mu      sync.Mutex
+	cookies map[cookieKey]*Cookie
+}
+
+func newRecordingJar(jar http.CookieJar) *recordingJar {
+	return &recordingJar{CookieJar: jar, cookies: make(map[cookieKey]*Cookie)}
+}
+
+// defaultCookiePath returns the default path of a cookie set by a response to u (RFC 6265 5.1.4)
+func defaultCookiePath(u *url.URL) string {
+	p := u.Path
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+	if i := strings.LastIndexByte(p, '/'); i > 0 {
+		return p[:i]
+	}
+	return "/"
+}
+
+func (jar *recordingJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	jar.CookieJar.SetCookies(u, cookies)
+
+	now := time.Now()
+	jar.mu.Lock()
+	defer jar.mu.Unlock()
+	for _, c := range cookies {
+		record := &Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   strings.ToLower(u.Hostname()),
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+			HostOnly: true,
+		}
+		if c.Domain != "" {
+			record.Domain = strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+			record.HostOnly = false
+		}
+		if record.Path == "" || record.Path[0] != '/' {
+			record.Path = defaultCookiePath(u)
+		}
+
+		switch {
+		case c.MaxAge < 0:
+			record.Expires = now
+		case c.MaxAge > 0:
+			record.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		default:
+			record.Expires = c.Expires
+		}
+
+		key := cookieKey{record.Domain, record.Path, record.Name}
+		if !record.Expires.IsZero() && !record.Expires.After(now) {
+			delete(jar.cookies, key)
+		} else if jar.accepted(u, record) {
+			jar.cookies[key] = record
+		}
+	}
+}
+
+// accepted reports whether the underlying jar kept cookie c set by a response to u
+func (jar *recordingJar) accepted(u *url.URL, c *Cookie) bool {
+	target := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: c.Path}
+	if c.Secure {
+		target.Scheme = "https"
+	}
+	for _, hc := range jar.CookieJar.Cookies(target) {
+		if hc.Name == c.Name && hc.Value == c.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the unexpired cookies recorded in jar
+func (jar *recordingJar) list() []*Cookie {
+	now := time.Now()
+	jar.mu.Lock()
+	defer jar.mu.Unlock()
+
+	cookies := make([]*Cookie, 0, len(jar.cookies))
+	for key, c := range jar.cookies {
+		if !c.Expires.IsZero() && !c.Expires.After(now) {
+			delete(jar.cookies, key)
+			continue
+		}
+		cookies = append(cookies, c)
+	}
+	sort.Slice(cookies, func(i, j int) bool {
+		if cookies[i].Domain != cookies[j].Domain {
+			return cookies[i].Domain < cookies[j].Domain
+		}
+		if cookies[i].Path != cookies[j].Path {
+			return cookies[i].Path < cookies[j].Path
+		}
+		return cookies[i].Name < cookies[j].Name
+	})
+	return cookies
+}
+
+// parseNetscapeCookies parses a Netscape/curl cookies.txt file
+func parseNetscapeCookies(data []byte) ([]*Cookie, error) {
+	var cookies []*Cookie
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		var httpOnly bool
+		if strings.HasPrefix(line, httpOnlyPrefix) {
+			line = line[len(httpOnlyPrefix):]
+			httpOnly = true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("cookies.txt line %d: expected 7 tab-separated fields", lineno)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookies.txt line %d: invalid expiration: %v", lineno, err)
+		}
+
+		c := &Cookie{
+			Domain:   strings.TrimPrefix(strings.ToLower(fields[0]), "."),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HTTPOnly: httpOnly,
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, scanner.Err()
+}
+
+func formatNetscapeCookies(cookies []*Cookie) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Netscape HTTP Cookie File\n\n")
+	for _, c := range cookies {
+		domain, subdomains := c.Domain, "FALSE"
+		if !c.HostOnly {
+			domain, subdomains = "."+c.Domain, "TRUE"
+		}
+		if c.HTTPOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		secure := "FALSE"
+		if c.Secure {
+			secure = "TRUE"
+		}
+		var expires int64
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+		fmt.Fprintf(&buf, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, subdomains, c.Path, secure, expires, c.Name, c.Value)
+	}
+	return buf.Bytes()
+}
+
+func isJSONCookieFile(filename string, data []byte) bool {
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return true
+	}
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '['
+}
+
+// LoadCookies loads the cookies of a Netscape cookies.txt or JSON file into the cookie jar
+func (crawler *Crawler) LoadCookies(filename string) error {
+	if crawler.client.Jar == nil {
+		return errCookiesDisabled
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var cookies []*Cookie
+	if isJSONCookieFile(filename, data) {
+		err = json.Unmarshal(data, &cookies)
+	} else {
+		cookies, err = parseNetscapeCookies(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, c := range cookies {
+		if c.Domain == "" || (!c.Expires.IsZero() && !c.Expires.After(now)) {
+			continue
+		}
+
+		u := &url.URL{Scheme: "http", Host: strings.TrimPrefix(c.Domain, "."), Path: c.Path}
+		if c.Secure {
+			u.Scheme = "https"
+		}
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		hc := &http.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     u.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HTTPOnly,
+		}
+		if !c.HostOnly {
+			hc.Domain = c.Domain
+		}
+		crawler.client.Jar.SetCookies(u, []*http.Cookie{hc})
+	}
+	return nil
+}
+
+// SaveCookies writes the cookies of the cookie jar to filename, in JSON if
+// its extension is .json and in Netscape cookies.txt format otherwise
+func (crawler *Crawler) SaveCookies(filename string) error {
+	jar, ok := crawler.client.Jar.(*recordingJar)
+	if !ok {
+		return errCookiesDisabled
+	}
+
+	cookies := jar.list()
+	var (
+		data []byte
+		err  error
+	)
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		if data, err = json.MarshalIndent(cookies, "", "    "); err != nil {
+			return err
+		}
+	} else {
+		data = formatNetscapeCookies(cookies)
+	}
+
+	if dir := filepath.Dir(filename); dir != "" {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	// cookies are credentials
+	return ioutil.WriteFile(filename, data, 0600)
+}
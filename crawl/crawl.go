@@ -1,7 +1,9 @@
 package crawl
 
 import (
+	"bytes"
 	"context"
+	"io/ioutil"
 	"log"
 	"mime"
 	"net/http"
@@ -11,7 +13,6 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/NzKSO/murphy/conf"
@@ -21,64 +22,130 @@ import (
 
 type URLTopological struct {
 	URL   *url.URL
+	Seed  *url.URL
 	Depth int
+	Level int
+	Score float64
 }
 
 // Crawler ...
 type Crawler struct {
 	client       *http.Client
+	transport    *http.Transport
+	certs        []*certTransport
+	tlsHosts     sync.Map
+	proxies      *proxyPool
+	router       *proxyRouter
 	crawledURL   *sync.Map
-	counter      int64
 	config       *conf.Configuration
+	politeness   *politeness
+	robots       *robotsCache
+	filters      []*filterRule
+	extractors   []*extractRule
+	captures     *captureLog
+	auth         []*authRule
+	session      *session
+	profiles     *profiles
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	mu           sync.Mutex
+	aborted      []string
+	retried      sync.Map
 	Semaphore    chan bool
-	URLTopoCh    chan *URLTopological
+	Frontier     *Frontier
 	Logger       *log.Logger
 	Server       *headless.Server
+	Checkpoint   *Checkpoint
+	Cache        *Cache
 	DownloadHTML bool
 }
 
 // New ...
 func New(config *conf.Configuration) *Crawler {
+	ctx, cancel := context.WithCancel(context.Background())
 	crawler := &Crawler{
+		ctx:        ctx,
+		cancel:     cancel,
 		client:     &http.Client{},
+		transport:  newTransport(config.Option),
 		crawledURL: &sync.Map{},
 		config:     config,
+		politeness: newPoliteness(
+			config.Option.HostRate,
+			time.Duration(config.Option.HostDelay)*time.Millisecond,
+			config.Option.HostMaxConcurrency,
+		),
+		robots:   newRobotsCache(),
+		profiles: newProfiles(config),
 	}
+	crawler.client.Transport = crawler.transport
+	crawler.client.CheckRedirect = crawler.checkRedirect
 
 	return crawler
 }
 
 // Crawl ...
 func (crawler *Crawler) Crawl(urlTopo *URLTopological) {
+	// page is urlTopo at the url it redirected to
+	page := urlTopo
+
 	defer func() {
 		if crawler.Semaphore != nil && len(crawler.Semaphore) > 0 {
 			<-crawler.Semaphore
 		}
 
-		if atomic.AddInt64(&crawler.counter, -1) == 0 && len(crawler.URLTopoCh) == 0 {
-			close(crawler.URLTopoCh)
-		}
+		crawler.Frontier.Done()
 	}()
 
-	atomic.AddInt64(&crawler.counter, 1)
+	defer func() {
+		if crawler.ctx.Err() != nil {
+			crawler.mu.Lock()
+			crawler.aborted = append(crawler.aborted, urlTopo.URL.String())
+			crawler.mu.Unlock()
+		} else if crawler.Checkpoint != nil {
+			crawler.Checkpoint.Done(urlTopo.URL.String())
+			if page != urlTopo {
+				crawler.Checkpoint.Done(page.URL.String())
+			}
+		}
+	}()
 
 	dir := filepath.Join(crawler.config.Dir, urlTopo.URL.Hostname())
 	os.Mkdir(dir, 0755)
 
 	rooturl := urlTopo.URL.String()
-	crawler.crawledURL.LoadOrStore(rooturl, true)
+	crawler.crawledURL.LoadOrStore(crawler.seenKey(urlTopo.URL), true)
+
+	if !crawler.allowedByRobots(urlTopo.URL) {
+		crawler.Logger.Printf("URL: %s, disallowed by robots.txt\n", rooturl)
+		return
+	}
 
 	if crawler.config.Headless.Enable {
-		resp, err := http.Head(rooturl)
+		req, err := createRequest(http.MethodHead, rooturl, crawler.config.UserAgent, nil)
+		if err != nil {
+			crawler.Logger.Printf("URL: %s, createRequest error: %v\n", rooturl, err)
+			return
+		}
+		req, chain := crawler.withRedirectChain(req, TargetPage, urlTopo.Seed)
+
+		resp, err := crawler.do(req)
 		if err != nil {
 			crawler.Logger.Printf("URL: %s, HTTP HEAD error: %v\n", rooturl, err)
 			return
 		}
-		defer resp.Body.Close()
+		// frees the host slot before parseHTML fetches assets from the same host
+		resp.Body.Close()
 
 		MIME, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
 		if MIME == "text/html" {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(crawler.config.Headless.Timeout)*time.Second)
+			var ok bool
+			if page, ok = crawler.redirectedPage(urlTopo, chain); !ok {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(crawler.ctx, time.Duration(crawler.config.Headless.Timeout)*time.Second)
 			defer cancel()
 
 			HTMLContent, err := crawler.Server.GetWebpageSourceCode(ctx, rooturl)
@@ -87,7 +154,7 @@ func (crawler *Crawler) Crawl(urlTopo *URLTopological) {
 				return
 			}
 
-			crawler.parseHTML(strings.NewReader(HTMLContent), urlTopo, dir)
+			crawler.parseHTML(strings.NewReader(HTMLContent), page, dir)
 			return
 		}
 	}
@@ -97,25 +164,40 @@ func (crawler *Crawler) Crawl(urlTopo *URLTopological) {
 		crawler.Logger.Printf("URL: %s, createRequest error: %v\n", rooturl, err)
 		return
 	}
+	req, chain := crawler.withRedirectChain(req, TargetPage, urlTopo.Seed)
 
-	resp, err := crawler.client.Do(req)
+	var cached *cacheEntry
+	if crawler.Cache != nil {
+		cached = crawler.Cache.conditional(req)
+	}
+
+	resp, err := crawler.do(req)
 	if err != nil {
 		crawler.Logger.Printf("URL: %s, HTTP GET error: %v\n", rooturl, err)
 		return
 	}
 	defer resp.Body.Close()
 
+	var ok bool
+	if page, ok = crawler.redirectedPage(urlTopo, chain); !ok {
+		return
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		// frees the host slot before the local copy is parsed
+		resp.Body.Close()
+		crawler.notModified(page, cached, dir)
+		return
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		crawler.Logger.Printf("URL: %s, status text: %v\n", rooturl, http.StatusText(resp.StatusCode))
 		return
 	}
 
-	if !resp.Uncompressed {
-		resp.Body, err = uncompressBody(resp)
-		if err != nil {
-			crawler.Logger.Printf("URL: %s, uncompress error: %v\n", rooturl, err)
-			return
-		}
+	if crawler.tooLarge(resp) {
+		crawler.Logger.Printf("URL: %s, Content-Length %d exceeds the maximum file size\n", rooturl, resp.ContentLength)
+		return
 	}
 
 	MIME, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
@@ -134,21 +216,273 @@ func (crawler *Crawler) Crawl(urlTopo *URLTopological) {
 			return
 		}
 
-		crawler.parseHTML(rd, urlTopo, dir)
+		content, err := ioutil.ReadAll(rd)
+		if err != nil {
+			crawler.Logger.Printf("URL: %s, Error reading webpage: %v", rooturl, err)
+			return
+		}
+		// frees the host slot before parseHTML fetches assets from the same host,
+		// some decoders stop before the end of the raw body
+		resp.Body.Close()
+
+		if crawler.Cache != nil {
+			if err = crawler.Cache.storePage(rooturl, resp.Header, content); err != nil {
+				crawler.Logger.Printf("URL: %s, Error caching webpage: %v", rooturl, err)
+			}
+		}
+
+		crawler.parseHTML(bytes.NewReader(content), page, dir)
 	default:
 		if ext, ok := MatchMIMEInExts(MIME, crawler.config.FileTypes); ok {
-			fileName := getFileName(urlTopo.URL.Path, ext)
+			fileName := getFileName(page.URL.Path, ext)
 			crawler.Logger.Printf("Found file %s on %v", fileName, resp.Request.URL.String())
-			if err := writeFile(resp.Body, dir, fileName); err != nil {
+			if err := crawler.writeFile(resp.Body, dir, fileName); err != nil {
 				crawler.Logger.Printf("Error writing file %s: %v", fileName, err)
+			} else if crawler.Cache != nil {
+				crawler.Cache.storeFile(rooturl, resp.Header, filepath.Join(dir, fileName))
 			}
 		}
 	}
 }
 
+// notModified handles a 304 Not Modified response to a conditional request,
+// the local copy of a webpage is parsed again and files are left as they are
+func (crawler *Crawler) notModified(urlTopo *URLTopological, cached *cacheEntry, dir string) {
+	rooturl := urlTopo.URL.String()
+	if cached.Hash == "" {
+		crawler.Logger.Printf("URL: %s, not modified since last run, skipped\n", rooturl)
+		return
+	}
+
+	content, err := crawler.Cache.page(cached)
+	if err != nil {
+		crawler.Logger.Printf("URL: %s, Error reading cached webpage: %v\n", rooturl, err)
+		return
+	}
+	crawler.Logger.Printf("URL: %s, not modified since last run, parsing local copy\n", rooturl)
+	crawler.parseHTML(bytes.NewReader(content), urlTopo, dir)
+}
+
+// Dispatch crawls urlTopo in a new goroutine
+func (crawler *Crawler) Dispatch(urlTopo *URLTopological) {
+	crawler.wg.Add(1)
+	go func() {
+		defer crawler.wg.Done()
+		crawler.Crawl(urlTopo)
+	}()
+}
+
+// Wait waits for dispatched crawls to finish, it returns false if timeout
+// elapses first, a timeout less than or equal to 0 means no limit
+func (crawler *Crawler) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		crawler.wg.Wait()
+		close(done)
+	}()
+
+	if timeout <= 0 {
+		<-done
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Abort cancels all in-flight requests
+func (crawler *Crawler) Abort() {
+	crawler.cancel()
+}
+
+// Aborted reports whether the crawl has been aborted
+func (crawler *Crawler) Aborted() bool {
+	return crawler.ctx.Err() != nil
+}
+
+// Unfinished returns the URLs that were aborted or are still waiting in the frontier
+func (crawler *Crawler) Unfinished() []string {
+	crawler.mu.Lock()
+	unfinished := append([]string(nil), crawler.aborted...)
+	crawler.mu.Unlock()
+
+	for _, urlTopo := range crawler.Frontier.Pending() {
+		unfinished = append(unfinished, urlTopo.URL.String())
+	}
+	return unfinished
+}
+
+// do sends req, if the response shows the session was logged out it logs in
+// again and sends req once more
+func (crawler *Crawler) do(req *http.Request) (*http.Response, error) {
+	if crawler.session == nil {
+		return crawler.fetch(req)
+	}
+
+	gen := crawler.session.generation()
+	resp, err := crawler.fetch(req)
+	if err != nil || !crawler.session.loggedOut(resp) {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	if err = crawler.relogin(gen); err != nil {
+		crawler.Logger.Printf("URL: %s, login error: %v\n", req.URL.String(), err)
+		return nil, errLoggedOut
+	}
+
+	// the client added the stale session cookies to req
+	req = req.Clone(req.Context())
+	req.Header.Del("Cookie")
+	return crawler.fetch(req)
+}
+
+// fetch sends req, decodes the body of the response according to its Content-Encoding
+// and caps its size
+func (crawler *Crawler) fetch(req *http.Request) (*http.Response, error) {
+	resp, err := crawler.retry(req)
+	if err != nil || req.Method == http.MethodHead ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return resp, err
+	}
+
+	if err = decodeBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if err = crawler.limitBody(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// retry sends req, retrying transient failures with a jittered exponential backoff
+func (crawler *Crawler) retry(req *http.Request) (*http.Response, error) {
+	// requests with a context of their own derive it from crawler.ctx
+	if req.Context() == context.Background() {
+		req = req.WithContext(crawler.ctx)
+	}
+	rawurl := req.URL.String()
+	retries := crawler.config.Option.Retries
+
+	for attempt := 0; ; attempt++ {
+		// each attempt sends a copy of req, the cookie jar adds its Cookie
+		// header field to the request it sends
+		attemptReq := req
+		if attempt > 0 {
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Header.Del("Cookie")
+		}
+		resp, err := crawler.send(attemptReq)
+		if !crawler.retryable(req.Method, resp, err) {
+			return resp, err
+		}
+
+		reason := "network error"
+		if err == nil {
+			reason = "status " + resp.Status
+		}
+		if attempt >= retries {
+			if retries > 0 {
+				crawler.Logger.Printf("Retry: URL: %s, giving up after %d attempts (%s)\n", rawurl, attempt+1, reason)
+			}
+			return resp, err
+		}
+
+		wait := crawler.backoff(attempt)
+		if d, ok := retryAfter(resp); ok {
+			if d > maxRetryAfter {
+				crawler.Logger.Printf("Retry: URL: %s, Retry-After %v too long, giving up\n", rawurl, d)
+				return resp, err
+			}
+			wait = d
+		}
+		if resp != nil {
+			discardBody(resp)
+		}
+
+		crawler.retried.Store(rawurl, attempt+2)
+		crawler.Logger.Printf("Retry: URL: %s, attempt %d/%d in %v (%s)\n", rawurl, attempt+2, retries+1, wait, reason)
+		if !crawler.sleep(wait) {
+			return nil, crawler.ctx.Err()
+		}
+	}
+}
+
+// send sends req with its profile and credentials once the per-host politeness limits allow it
+func (crawler *Crawler) send(req *http.Request) (*http.Response, error) {
+	crawler.identify(req)
+	crawler.authorize(req)
+
+	release, err := crawler.politeness.acquire(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	// redirects to other hosts move the slot to their host
+	slot := &hostSlot{host: req.URL.Host, release: release}
+	req = req.WithContext(context.WithValue(req.Context(), hostSlotKey{}, slot))
+
+	req, choice := crawler.withProxyChoice(req)
+	resp, err := crawler.client.Do(req)
+	crawler.reportProxy(choice, resp, err)
+	if err != nil {
+		slot.release()
+		return nil, err
+	}
+	crawler.logTLS(resp)
+	if req.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		// no body to wait for
+		slot.release()
+	}
+	resp.Body = &releaseBody{resp.Body, slot.release}
+	return resp, nil
+}
+
+// Enqueue pushes urlTopo to the frontier unless its canonical url has been seen before
+func (crawler *Crawler) Enqueue(urlTopo *URLTopological) bool {
+	if _, loaded := crawler.crawledURL.LoadOrStore(crawler.seenKey(urlTopo.URL), true); loaded {
+		return false
+	}
+
+	if crawler.Checkpoint != nil {
+		crawler.Checkpoint.Push(urlTopo)
+	}
+	crawler.Frontier.Push(urlTopo)
+	return true
+}
+
+// Restore marks URLs recorded in checkpoint as crawled and returns the pending ones
+func (crawler *Crawler) Restore() []*URLTopological {
+	if crawler.Checkpoint == nil {
+		return nil
+	}
+
+	for _, rawurl := range crawler.Checkpoint.Seen() {
+		if u, err := url.Parse(rawurl); err == nil {
+			crawler.crawledURL.Store(crawler.seenKey(u), true)
+		}
+	}
+
+	pending := crawler.Checkpoint.Pending()
+	for _, urlTopo := range pending {
+		crawler.crawledURL.Store(crawler.seenKey(urlTopo.URL), true)
+	}
+	return pending
+}
+
 // SetProxy sets proxy for crawler
 func (crawler *Crawler) SetProxy(proxy func(*http.Request) (*url.URL, error)) {
-	crawler.client.Transport = &http.Transport{Proxy: proxy}
+	crawler.transport.Proxy = proxy
+	for _, ct := range crawler.certs {
+		ct.transport.Proxy = proxy
+	}
 }
 
 // EnableCookie ...
@@ -158,7 +492,7 @@ func (crawler *Crawler) EnableCookie() {
 		crawler.Logger.Println(err)
 		return
 	}
-	crawler.client.Jar = jar
+	crawler.client.Jar = newRecordingJar(jar)
 }
 
 // SetTimeout ...
@@ -0,0 +1,526 @@
+package crawl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	partSuffix              = ".part"
+	partMetaSuffix          = ".json"
+	defaultSegmentThreshold = 64 * 1024 * 1024
+	partSaveInterval        = time.Second
+)
+
+var errResourceChanged = errors.New("resource changed since the partial download, partial download discarded")
+
+type partSegment struct {
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"`
+	Written int64 `json:"written"`
+}
+
+// partMeta describes a partial download kept next to its .part file so that it can be resumed
+type partMeta struct {
+	URL          string         `json:"url"`
+	ETag         string         `json:"etag,omitempty"`
+	LastModified string         `json:"lastModified,omitempty"`
+	Length       int64          `json:"length"`
+	Segments     []*partSegment `json:"segments,omitempty"`
+}
+
+// validator returns the strong validator to send in If-Range, weak ETags can't be used
+func (meta *partMeta) validator() string {
+	if meta.ETag != "" && !strings.HasPrefix(meta.ETag, "W/") {
+		return meta.ETag
+	}
+	return meta.LastModified
+}
+
+// header returns the validators of meta as response header fields
+func (meta *partMeta) header() http.Header {
+	header := make(http.Header)
+	if meta.ETag != "" {
+		header.Set("ETag", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		header.Set("Last-Modified", meta.LastModified)
+	}
+	return header
+}
+
+func loadPartMeta(partPath, rawurl string) *partMeta {
+	data, err := ioutil.ReadFile(partPath + partMetaSuffix)
+	if err != nil {
+		return nil
+	}
+
+	var meta partMeta
+	if err = json.Unmarshal(data, &meta); err != nil || meta.URL != rawurl || meta.validator() == "" {
+		return nil
+	}
+	if _, err = os.Stat(partPath); err != nil {
+		return nil
+	}
+	return &meta
+}
+
+// savePartMeta replaces the metadata file of partPath atomically
+func savePartMeta(partPath string, meta *partMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(partPath), filepath.Base(partPath)+partMetaSuffix+".")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), partPath+partMetaSuffix)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// snapshot returns a copy of meta, its segments are updated concurrently
+func (meta *partMeta) snapshot() *partMeta {
+	snap := *meta
+	snap.Segments = make([]*partSegment, len(meta.Segments))
+	for i, seg := range meta.Segments {
+		s := *seg
+		snap.Segments[i] = &s
+	}
+	return &snap
+}
+
+func removePart(partPath string) {
+	os.Remove(partPath)
+	os.Remove(partPath + partMetaSuffix)
+}
+
+// parseContentRange parses a "bytes first-last/complete" Content-Range header,
+// complete is -1 if unknown, the unsatisfied range form "bytes */complete" isn't accepted
+func parseContentRange(val string) (first, last, complete int64, ok bool) {
+	if !strings.HasPrefix(val, "bytes ") {
+		return 0, 0, 0, false
+	}
+	val = val[len("bytes "):]
+
+	slashIdx := strings.IndexByte(val, '/')
+	dashIdx := strings.IndexByte(val, '-')
+	if slashIdx == -1 || dashIdx == -1 || dashIdx > slashIdx {
+		return 0, 0, 0, false
+	}
+
+	var err error
+	if first, err = strconv.ParseInt(val[:dashIdx], 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	if last, err = strconv.ParseInt(val[dashIdx+1:slashIdx], 10, 64); err != nil || last < first {
+		return 0, 0, 0, false
+	}
+	complete = -1
+	if val[slashIdx+1:] != "*" {
+		if complete, err = strconv.ParseInt(val[slashIdx+1:], 10, 64); err != nil || last >= complete {
+			return 0, 0, 0, false
+		}
+	}
+	return first, last, complete, true
+}
+
+func (crawler *Crawler) newDownloadRequest(rawurl string) (*http.Request, error) {
+	req, err := createRequest(http.MethodGet, rawurl, crawler.config.UserAgent, nil)
+	if err != nil {
+		return nil, err
+	}
+	// byte ranges must address the stored bytes, not an encoded representation
+	req.Header.Set("Accept-Encoding", "identity")
+	return req, nil
+}
+
+// download fetches u into dir/fileName through a .part file, a previous partial
+// download is resumed with a range request and files larger than the segment
+// threshold are fetched with parallel range requests when the server supports it,
+// redirects are checked against the scope of seed
+func (crawler *Crawler) download(u, seed *url.URL, dir, fileName, ext string) (err error) {
+	rawurl := u.String()
+	partPath := filepath.Join(dir, fileName+partSuffix)
+	meta := loadPartMeta(partPath, rawurl)
+
+	if meta != nil && len(meta.Segments) > 0 {
+		crawler.Logger.Printf("URL: %s, resuming segmented download\n", rawurl)
+		return crawler.downloadSegments(u, dir, fileName, meta)
+	}
+
+	var offset int64
+	if meta != nil {
+		if fi, err := os.Stat(partPath); err == nil {
+			offset = fi.Size()
+		}
+	}
+
+	req, err := crawler.newDownloadRequest(rawurl)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", meta.validator())
+	} else if crawler.Cache != nil {
+		crawler.Cache.conditional(req)
+	}
+	req, chain := crawler.withRedirectChain(req, TargetAsset, seed)
+
+	resp, err := crawler.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	final, seen := crawler.redirected(u, chain)
+	if seen {
+		crawler.Logger.Printf("URL: %s, redirected to %s which has already been downloaded\n", rawurl, final.String())
+		return nil
+	}
+	if final != nil && crawler.Checkpoint != nil {
+		defer func() {
+			if err == nil {
+				crawler.Checkpoint.Done(final.String())
+			}
+		}()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		first, _, complete, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || first != offset || (meta.Length > 0 && complete != meta.Length) {
+			removePart(partPath)
+			return errors.New("unexpected Content-Range, partial download discarded")
+		}
+		crawler.Logger.Printf("URL: %s, resuming download at byte %d\n", rawurl, offset)
+	case http.StatusOK:
+		offset = 0
+		meta = &partMeta{
+			URL:          rawurl,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Length:       resp.ContentLength,
+		}
+
+		if crawler.tooLarge(resp) {
+			return errFileTooLarge
+		}
+
+		MIME, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if ext != "" && MIME != mime.TypeByExtension(ext) {
+			crawler.Logger.Printf("URL: %s, MIME type in Content-Type mismatch file extension name", rawurl)
+		}
+
+		if crawler.segmentable(resp, meta) {
+			discardBody(resp)
+			meta.Segments = splitSegments(meta.Length, crawler.config.Option.Segments)
+			crawler.Logger.Printf("URL: %s, downloading %d bytes in %d segments\n", rawurl, meta.Length, len(meta.Segments))
+			return crawler.downloadSegments(u, dir, fileName, meta)
+		}
+	case http.StatusNotModified:
+		crawler.Logger.Printf("URL: %s, not modified since last run, skipped\n", rawurl)
+		return nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		removePart(partPath)
+		return errors.New("range not satisfiable, partial download discarded")
+	default:
+		return errors.New("status text: " + http.StatusText(resp.StatusCode))
+	}
+
+	resumable := resp.Header.Get("Accept-Ranges") == "bytes" && !resp.Uncompressed && meta.validator() != ""
+	if err = crawler.writePart(resp.Body, partPath, offset, meta, resumable); err != nil {
+		if !resumable || err == errFileTooLarge {
+			removePart(partPath)
+		}
+		return err
+	}
+	return crawler.finishDownload(partPath, filepath.Join(dir, fileName), meta)
+}
+
+func (crawler *Crawler) segmentable(resp *http.Response, meta *partMeta) bool {
+	threshold := crawler.config.Option.SegmentThreshold
+	if threshold <= 0 {
+		threshold = defaultSegmentThreshold
+	}
+	return crawler.config.Option.Segments > 1 &&
+		resp.Header.Get("Accept-Ranges") == "bytes" &&
+		!resp.Uncompressed &&
+		meta.validator() != "" &&
+		meta.Length >= threshold
+}
+
+func splitSegments(length int64, n int) []*partSegment {
+	size := length / int64(n)
+	segments := make([]*partSegment, n)
+	for i := range segments {
+		segments[i] = &partSegment{Start: int64(i) * size, End: int64(i+1)*size - 1}
+	}
+	segments[n-1].End = length - 1
+	return segments
+}
+
+// writePart appends body to the .part file at offset, the metadata is saved
+// beforehand if the download can be resumed
+func (crawler *Crawler) writePart(body io.Reader, partPath string, offset int64, meta *partMeta, resumable bool) error {
+	if resumable {
+		if err := savePartMeta(partPath, meta); err != nil {
+			return err
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	maxBytes := crawler.config.Option.MaxFileSize
+	if maxBytes > 0 {
+		body = io.LimitReader(body, maxBytes-offset+1)
+	}
+
+	n, err := io.Copy(f, body)
+	if err == nil && maxBytes > 0 && offset+n > maxBytes {
+		err = errFileTooLarge
+	}
+	if err == nil && meta.Length >= 0 && offset+n != meta.Length {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// downloadSegments fetches the unfinished segments of meta in parallel into the .part file
+func (crawler *Crawler) downloadSegments(u *url.URL, dir, fileName string, meta *partMeta) error {
+	partPath := filepath.Join(dir, fileName+partSuffix)
+	if max := crawler.config.Option.MaxFileSize; max > 0 && meta.Length > max {
+		removePart(partPath)
+		return errFileTooLarge
+	}
+
+	f, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(meta.Length); err == nil {
+		err = savePartMeta(partPath, meta)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		errs  = make(chan error, len(meta.Segments))
+		done  = make(chan struct{})
+		saved = make(chan struct{})
+	)
+	go func() {
+		crawler.saveSegments(f, partPath, meta, &mu, done)
+		close(saved)
+	}()
+	for _, seg := range meta.Segments {
+		if seg.Written > seg.End-seg.Start {
+			continue
+		}
+		wg.Add(1)
+		go func(seg *partSegment) {
+			defer wg.Done()
+			errs <- crawler.fetchSegment(u, f, seg, meta, &mu)
+		}(seg)
+	}
+	wg.Wait()
+	close(errs)
+	close(done)
+	<-saved
+
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	for serr := range errs {
+		if serr == errResourceChanged {
+			removePart(partPath)
+			return serr
+		}
+		if err == nil {
+			err = serr
+		}
+	}
+
+	mu.Lock()
+	if serr := savePartMeta(partPath, meta); err == nil {
+		err = serr
+	}
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(partPath)
+	if err != nil {
+		return err
+	}
+	if fi.Size() != meta.Length {
+		removePart(partPath)
+		return errors.New("segmented download size mismatch Content-Length")
+	}
+	return crawler.finishDownload(partPath, filepath.Join(dir, fileName), meta)
+}
+
+// saveSegments saves the progress of the segments of meta every partSaveInterval
+// and when the crawl is aborted until done is closed, so that an interrupted
+// download resumes where its segments stopped
+func (crawler *Crawler) saveSegments(f *os.File, partPath string, meta *partMeta, mu *sync.Mutex, done chan struct{}) {
+	ticker := time.NewTicker(partSaveInterval)
+	defer ticker.Stop()
+
+	ctxDone := crawler.ctx.Done()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctxDone:
+			ctxDone = nil
+		case <-ticker.C:
+		}
+
+		mu.Lock()
+		snap := meta.snapshot()
+		mu.Unlock()
+		// segments are written before their progress, sync them before saving it
+		if err := f.Sync(); err != nil {
+			continue
+		}
+		if err := savePartMeta(partPath, snap); err != nil {
+			crawler.Logger.Printf("URL: %s, Error saving download progress: %v\n", meta.URL, err)
+		}
+	}
+}
+
+func (crawler *Crawler) fetchSegment(u *url.URL, f *os.File, seg *partSegment, meta *partMeta, mu *sync.Mutex) error {
+	mu.Lock()
+	start := seg.Start + seg.Written
+	mu.Unlock()
+
+	req, err := crawler.newDownloadRequest(u.String())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, seg.End))
+	req.Header.Set("If-Range", meta.validator())
+
+	resp, err := crawler.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return errResourceChanged
+	default:
+		return errors.New("status text: " + http.StatusText(resp.StatusCode))
+	}
+
+	if etag := resp.Header.Get("ETag"); meta.ETag != "" && etag != "" && etag != meta.ETag {
+		return errResourceChanged
+	}
+	first, last, complete, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || first != start || last != seg.End || complete != meta.Length {
+		return errors.New("unexpected Content-Range " + resp.Header.Get("Content-Range"))
+	}
+
+	buf := make([]byte, 32*1024)
+	offset := start
+	for offset <= seg.End {
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			if int64(n) > seg.End-offset+1 {
+				n = int(seg.End - offset + 1)
+			}
+			if _, err := f.WriteAt(buf[:n], offset); err != nil {
+				return err
+			}
+			offset += int64(n)
+			mu.Lock()
+			seg.Written = offset - seg.Start
+			mu.Unlock()
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+
+	if offset <= seg.End {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// finishDownload moves a completed download to path and records it in the cache
+func (crawler *Crawler) finishDownload(partPath, path string, meta *partMeta) error {
+	if err := finishPart(partPath, path); err != nil {
+		return err
+	}
+	if crawler.Cache != nil {
+		crawler.Cache.storeFile(meta.URL, meta.header(), path)
+	}
+	return nil
+}
+
+// finishPart renames a completed .part file to its final name and removes its metadata
+func finishPart(partPath, path string) error {
+	if err := os.Chmod(partPath, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		return err
+	}
+	os.Remove(partPath + partMetaSuffix)
+	return nil
+}
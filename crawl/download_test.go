@@ -0,0 +1,58 @@
+package crawl
+
+import "testing"
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		val                   string
+		first, last, complete int64
+		ok                    bool
+	}{
+		{"bytes 0-499/1234", 0, 499, 1234, true},
+		{"bytes 500-1233/1234", 500, 1233, 1234, true},
+		{"bytes 0-0/1", 0, 0, 1, true},
+		{"bytes 42-1233/*", 42, 1233, -1, true},
+		{"bytes */1234", 0, 0, 0, false},
+		{"bytes 0-1234/1234", 0, 0, 0, false},
+		{"bytes 500-499/1234", 0, 0, 0, false},
+		{"bytes -499/1234", 0, 0, 0, false},
+		{"bytes 0-/1234", 0, 0, 0, false},
+		{"bytes 0-499", 0, 0, 0, false},
+		{"bytes 0/499-1234", 0, 0, 0, false},
+		{"bytes a-b/c", 0, 0, 0, false},
+		{"items 0-499/1234", 0, 0, 0, false},
+		{"", 0, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		first, last, complete, ok := parseContentRange(tt.val)
+		if ok != tt.ok || (ok && (first != tt.first || last != tt.last || complete != tt.complete)) {
+			t.Errorf("parseContentRange(%q) = %d, %d, %d, %v, want %d, %d, %d, %v",
+				tt.val, first, last, complete, ok, tt.first, tt.last, tt.complete, tt.ok)
+		}
+	}
+}
+
+func TestSplitSegments(t *testing.T) {
+	tests := []struct {
+		length int64
+		n      int
+		want   [][2]int64
+	}{
+		{100, 1, [][2]int64{{0, 99}}},
+		{100, 4, [][2]int64{{0, 24}, {25, 49}, {50, 74}, {75, 99}}},
+		{10, 3, [][2]int64{{0, 2}, {3, 5}, {6, 9}}},
+	}
+
+	for _, tt := range tests {
+		segments := splitSegments(tt.length, tt.n)
+		if len(segments) != len(tt.want) {
+			t.Fatalf("splitSegments(%d, %d) returned %d segments, want %d", tt.length, tt.n, len(segments), len(tt.want))
+		}
+		for i, seg := range segments {
+			if seg.Start != tt.want[i][0] || seg.End != tt.want[i][1] {
+				t.Errorf("splitSegments(%d, %d)[%d] = %d-%d, want %d-%d", tt.length, tt.n, i, seg.Start, seg.End, tt.want[i][0], tt.want[i][1])
+			}
+		}
+	}
+}
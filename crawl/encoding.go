@@ -0,0 +1,112 @@
+package crawl
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding lists the content codings decodeBody supports
+const acceptEncoding = "gzip, deflate, br, zstd"
+
+// decodedBody reads the decoded content of a response body and closes every decoding layer
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (db *decodedBody) Close() error {
+	var err error
+	for i := len(db.closers) - 1; i >= 0; i-- {
+		if cerr := db.closers[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// isZlib reports whether header is a valid zlib stream header (RFC 1950)
+func isZlib(header []byte) bool {
+	return header[0]&0x0f == 8 && header[0]>>4 <= 7 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+func newDecoder(coding string, rd io.Reader) (io.Reader, io.Closer, error) {
+	switch coding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(rd)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr, nil
+	case "deflate":
+		// deflate is supposed to be zlib-wrapped but some servers send raw deflate
+		br := bufio.NewReader(rd)
+		if header, err := br.Peek(2); err == nil && isZlib(header) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, nil, err
+			}
+			return zr, zr, nil
+		}
+		fr := flate.NewReader(br)
+		return fr, fr, nil
+	case "br":
+		return brotli.NewReader(rd), nil, nil
+	case "zstd":
+		zr, err := zstd.NewReader(rd, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		rc := zr.IOReadCloser()
+		return rc, rc, nil
+	default:
+		return nil, nil, errors.New("unsupported Content-Encoding: " + coding)
+	}
+}
+
+// decodeBody replaces the body of resp by its decoded content, codings listed in
+// Content-Encoding are removed in the reverse order they were applied
+func decodeBody(resp *http.Response) error {
+	if resp.Uncompressed {
+		return nil
+	}
+
+	var codings []string
+	for _, coding := range strings.Split(resp.Header.Get("Content-Encoding"), ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "" && coding != "identity" {
+			codings = append(codings, coding)
+		}
+	}
+	if len(codings) == 0 {
+		return nil
+	}
+
+	body := &decodedBody{Reader: resp.Body, closers: []io.Closer{resp.Body}}
+	for i := len(codings) - 1; i >= 0; i-- {
+		rd, closer, err := newDecoder(codings[i], body.Reader)
+		if err != nil {
+			body.Close()
+			return err
+		}
+		body.Reader = rd
+		if closer != nil {
+			body.closers = append(body.closers, closer)
+		}
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
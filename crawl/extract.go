@@ -0,0 +1,156 @@
+package crawl
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/NzKSO/murphy/conf"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// Extraction rule purposes
+const (
+	ExtractFollow   = "follow"
+	ExtractDownload = "download"
+	ExtractCapture  = "capture"
+)
+
+// capturesFile holds a JSON record per captured value, in the output directory
+const capturesFile = "captures.jsonl"
+
+type extractRule struct {
+	name    string
+	sel     cascadia.Selector
+	attr    string
+	purpose string
+}
+
+// capture is a value captured by an extraction rule
+type capture struct {
+	URL   string `json:"url"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// captureLog appends captured values to the captures file
+type captureLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func compileExtractRules(extracts []conf.Extract) ([]*extractRule, error) {
+	rules := make([]*extractRule, 0, len(extracts))
+	for _, e := range extracts {
+		switch e.Purpose {
+		case ExtractFollow, ExtractDownload, ExtractCapture:
+		default:
+			return nil, errors.New("invalid extraction purpose: " + e.Purpose)
+		}
+
+		sel, err := cascadia.Compile(e.Selector)
+		if err != nil {
+			return nil, errors.New("invalid extraction selector " + e.Selector + ": " + err.Error())
+		}
+
+		name := e.Name
+		if name == "" {
+			name = e.Selector
+		}
+		rules = append(rules, &extractRule{name: name, sel: sel, attr: e.Attr, purpose: e.Purpose})
+	}
+	return rules, nil
+}
+
+// SetExtractRules sets the rules applied to the DOM of every webpage, captured
+// values are appended to captures.jsonl in the output directory
+func (crawler *Crawler) SetExtractRules(extracts []conf.Extract) error {
+	rules, err := compileExtractRules(extracts)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if rule.purpose != ExtractCapture {
+			continue
+		}
+		f, err := os.OpenFile(filepath.Join(crawler.config.Dir, capturesFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		crawler.captures = &captureLog{f: f}
+		break
+	}
+
+	crawler.extractors = rules
+	return nil
+}
+
+// CloseCaptures closes the captures file
+func (crawler *Crawler) CloseCaptures() error {
+	if crawler.captures == nil {
+		return nil
+	}
+	crawler.captures.mu.Lock()
+	defer crawler.captures.mu.Unlock()
+	return crawler.captures.f.Close()
+}
+
+func (cl *captureLog) write(c *capture) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	_, err = cl.f.Write(append(data, '\n'))
+	return err
+}
+
+// nodeText returns the text of node and its descendants with whitespace collapsed
+func nodeText(node *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(node)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// extract applies the extraction rules to doc, the DOM of the webpage of urlTopo
+func (crawler *Crawler) extract(doc *html.Node, urlTopo *URLTopological, dir string) {
+	for _, rule := range crawler.extractors {
+		for _, node := range rule.sel.MatchAll(doc) {
+			val := nodeText(node)
+			if rule.attr != "" {
+				val = strings.TrimSpace(htmlAttr(node, rule.attr))
+			}
+			if val == "" {
+				continue
+			}
+
+			switch rule.purpose {
+			case ExtractFollow:
+				crawler.follow(urlTopo, val)
+			case ExtractDownload:
+				crawler.fetchRef(urlTopo, val, dir)
+			case ExtractCapture:
+				if err := crawler.captures.write(&capture{URL: urlTopo.URL.String(), Name: rule.name, Value: val}); err != nil {
+					crawler.Logger.Printf("URL: %s, Error writing capture %s: %v\n", urlTopo.URL.String(), rule.name, err)
+				}
+			}
+		}
+	}
+}
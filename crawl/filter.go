@@ -0,0 +1,129 @@
+package crawl
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/NzKSO/murphy/conf"
+)
+
+// Filter targets and actions
+const (
+	TargetPage  = "page"
+	TargetAsset = "asset"
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+const defaultDenyRule = "default (no allow rule matched)"
+
+type filterRule struct {
+	name   string
+	allow  bool
+	target string
+	path   bool
+	re     *regexp.Regexp
+}
+
+// globToRegexp converts a glob pattern, where ** matches anything, * and ? match
+// anything but '/', into an anchored regular expression
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteByte('^')
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteByte('$')
+	return sb.String()
+}
+
+func compileFilters(filters []conf.Filter) ([]*filterRule, error) {
+	rules := make([]*filterRule, 0, len(filters))
+	for _, f := range filters {
+		if f.Action != ActionAllow && f.Action != ActionDeny {
+			return nil, errors.New("invalid filter action: " + f.Action)
+		}
+		if f.Target != "" && f.Target != TargetPage && f.Target != TargetAsset {
+			return nil, errors.New("invalid filter target: " + f.Target)
+		}
+
+		var expr string
+		switch {
+		case f.Regex != "" && f.Glob != "":
+			return nil, errors.New("filter can't have both regex and glob: " + f.Name)
+		case f.Regex != "":
+			expr = f.Regex
+		case f.Glob != "":
+			expr = globToRegexp(f.Glob)
+		default:
+			return nil, errors.New("filter requires a regex or glob: " + f.Name)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		name := f.Name
+		if name == "" {
+			name = f.Action + " " + f.Regex + f.Glob
+		}
+		rules = append(rules, &filterRule{
+			name:   name,
+			allow:  f.Action == ActionAllow,
+			target: f.Target,
+			path:   f.Path,
+			re:     re,
+		})
+	}
+	return rules, nil
+}
+
+// SetFilters sets the ordered allow/deny rules applied to discovered URLs
+func (crawler *Crawler) SetFilters(filters []conf.Filter) error {
+	rules, err := compileFilters(filters)
+	if err != nil {
+		return err
+	}
+	crawler.filters = rules
+	return nil
+}
+
+// rejected returns the name of the rule rejecting u for target, the first matching
+// rule wins and u is rejected if no rule matches while allow rules exist for target
+func (crawler *Crawler) rejected(u *url.URL, target string) (string, bool) {
+	var hasAllow bool
+	for _, rule := range crawler.filters {
+		if rule.target != "" && rule.target != target {
+			continue
+		}
+		hasAllow = hasAllow || rule.allow
+
+		subject := u.String()
+		if rule.path {
+			subject = u.EscapedPath()
+		}
+		if rule.re.MatchString(subject) {
+			return rule.name, !rule.allow
+		}
+	}
+
+	if hasAllow {
+		return defaultDenyRule, true
+	}
+	return "", false
+}
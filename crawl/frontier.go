@@ -0,0 +1,211 @@
+package crawl
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Crawl orders supported by Frontier
+const (
+	OrderBFS      = "bfs"
+	OrderDFS      = "dfs"
+	OrderPriority = "priority"
+)
+
+type frontierItem struct {
+	urlTopo  *URLTopological
+	seq      int64
+	hostRank int
+}
+
+type frontierHeap struct {
+	items []*frontierItem
+	less  func(a, b *frontierItem) bool
+}
+
+func (h *frontierHeap) Len() int           { return len(h.items) }
+func (h *frontierHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+func (h *frontierHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *frontierHeap) Push(x interface{}) { h.items = append(h.items, x.(*frontierItem)) }
+func (h *frontierHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[:n-1]
+	return item
+}
+
+// breadth-first, shallow pages first and discovery order within a level
+func lessBFS(a, b *frontierItem) bool {
+	if a.urlTopo.Level != b.urlTopo.Level {
+		return a.urlTopo.Level < b.urlTopo.Level
+	}
+	return a.seq < b.seq
+}
+
+// depth-first, most recently discovered page first
+func lessDFS(a, b *frontierItem) bool {
+	return a.seq > b.seq
+}
+
+// highest score first, then shallow pages, then round-robin across hosts
+func lessPriority(a, b *frontierItem) bool {
+	if a.urlTopo.Score != b.urlTopo.Score {
+		return a.urlTopo.Score > b.urlTopo.Score
+	}
+	if a.urlTopo.Level != b.urlTopo.Level {
+		return a.urlTopo.Level < b.urlTopo.Level
+	}
+	if a.hostRank != b.hostRank {
+		return a.hostRank < b.hostRank
+	}
+	return a.seq < b.seq
+}
+
+// Frontier holds the URLs waiting to be crawled in the configured order, it is
+// finished once it is empty, nothing is in flight and nothing is held
+type Frontier struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	heap     frontierHeap
+	seq      int64
+	hosts    map[string]int
+	inflight int
+	holds    int
+	closed   bool
+}
+
+// ValidOrder reports whether order is a supported crawl order
+func ValidOrder(order string) bool {
+	switch order {
+	case "", OrderBFS, OrderDFS, OrderPriority:
+		return true
+	}
+	return false
+}
+
+// NewFrontier returns an empty frontier using given crawl order, breadth-first by default
+func NewFrontier(order string) (*Frontier, error) {
+	f := &Frontier{hosts: make(map[string]int)}
+	f.cond = sync.NewCond(&f.mu)
+
+	switch order {
+	case "", OrderBFS:
+		f.heap.less = lessBFS
+	case OrderDFS:
+		f.heap.less = lessDFS
+	case OrderPriority:
+		f.heap.less = lessPriority
+	default:
+		return nil, errors.New("unknown crawl order: " + order)
+	}
+	return f, nil
+}
+
+// Push adds urlTopo to the frontier
+func (f *Frontier) Push(urlTopo *URLTopological) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.push(urlTopo)
+}
+
+// push adds urlTopo to the heap, f.mu must be held
+func (f *Frontier) push(urlTopo *URLTopological) {
+	f.seq++
+	host := urlTopo.URL.Host
+	heap.Push(&f.heap, &frontierItem{urlTopo: urlTopo, seq: f.seq, hostRank: f.hosts[host]})
+	f.hosts[host]++
+	f.cond.Signal()
+}
+
+// Pop blocks until a URL is available and marks it in flight, it returns false
+// once the frontier is finished or closed
+func (f *Frontier) Pop() (*URLTopological, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for f.heap.Len() == 0 && !f.closed && (f.inflight > 0 || f.holds > 0) {
+		f.cond.Wait()
+	}
+	if f.closed || f.heap.Len() == 0 {
+		return nil, false
+	}
+
+	f.inflight++
+	return heap.Pop(&f.heap).(*frontierItem).urlTopo, true
+}
+
+// Done marks a URL returned by Pop as crawled
+func (f *Frontier) Done() {
+	f.mu.Lock()
+	f.inflight--
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// Requeue puts back a URL returned by Pop that won't be crawled, even once the
+// frontier is closed, so that it's still pending
+func (f *Frontier) Requeue(urlTopo *URLTopological) {
+	f.mu.Lock()
+	f.push(urlTopo)
+	f.inflight--
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// Hold keeps the frontier from finishing while URLs are still being seeded
+func (f *Frontier) Hold() {
+	f.mu.Lock()
+	f.holds++
+	f.mu.Unlock()
+}
+
+// Release undoes a previous Hold
+func (f *Frontier) Release() {
+	f.mu.Lock()
+	f.holds--
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// Close stops the frontier, pending Pop calls return false and further pushes are dropped
+func (f *Frontier) Close() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// Closed reports whether the frontier has been closed
+func (f *Frontier) Closed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+// Pending returns the URLs waiting to be crawled in crawl order
+func (f *Frontier) Pending() []*URLTopological {
+	f.mu.Lock()
+	items := append([]*frontierItem(nil), f.heap.items...)
+	f.mu.Unlock()
+
+	sort.Slice(items, func(i, j int) bool { return f.heap.less(items[i], items[j]) })
+	pending := make([]*URLTopological, len(items))
+	for i, item := range items {
+		pending[i] = item.urlTopo
+	}
+	return pending
+}
+
+// Len returns the number of URLs waiting to be crawled
+func (f *Frontier) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.heap.Len()
+}
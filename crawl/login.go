@@ -0,0 +1,237 @@
+package crawl
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/NzKSO/murphy/conf"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+var errLoggedOut = errors.New("logged out and login failed")
+
+// session performs the configured login and keeps track of logins so that
+// concurrent requests detecting a logged out session log in only once
+type session struct {
+	mu                sync.Mutex
+	gen               int
+	login             *conf.Login
+	fields            url.Values
+	csrf              cascadia.Selector
+	successRedirect   *regexp.Regexp
+	loggedOutRedirect *regexp.Regexp
+}
+
+// SetLogin sets the login performed by Login and on logged out responses,
+// a nil login disables it
+func (crawler *Crawler) SetLogin(login *conf.Login) error {
+	if login == nil {
+		crawler.session = nil
+		return nil
+	}
+	if login.URL == "" {
+		return errors.New("login requires a url")
+	}
+
+	s := &session{login: login, fields: make(url.Values)}
+	for key, val := range login.Fields {
+		secret, err := resolveSecret(val)
+		if err != nil {
+			return err
+		}
+		s.fields.Set(key, secret)
+	}
+
+	var err error
+	if login.CSRFSelector != "" {
+		if s.csrf, err = cascadia.Compile(login.CSRFSelector); err != nil {
+			return err
+		}
+	}
+	if login.SuccessRedirect != "" {
+		if s.successRedirect, err = regexp.Compile(login.SuccessRedirect); err != nil {
+			return err
+		}
+	}
+	if login.LoggedOutRedirect != "" {
+		if s.loggedOutRedirect, err = regexp.Compile(login.LoggedOutRedirect); err != nil {
+			return err
+		}
+	}
+
+	crawler.session = s
+	return nil
+}
+
+// Login logs in with the configured login, the session cookies are kept in
+// the cookie jar of crawler for the whole crawl
+func (crawler *Crawler) Login() error {
+	if crawler.session == nil {
+		return nil
+	}
+	if crawler.client.Jar == nil {
+		return errors.New("login requires cookies to be enabled")
+	}
+
+	crawler.session.mu.Lock()
+	defer crawler.session.mu.Unlock()
+	return crawler.login()
+}
+
+func (crawler *Crawler) login() error {
+	s := crawler.session
+	s.gen++
+
+	req, err := createRequest(http.MethodGet, s.login.URL, crawler.config.UserAgent, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := crawler.fetch(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("login page status text: " + http.StatusText(resp.StatusCode))
+	}
+
+	doc, err := html.Parse(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	action := resp.Request.URL
+	fields := make(url.Values)
+	for key, vals := range s.fields {
+		fields[key] = vals
+	}
+
+	if s.csrf != nil {
+		node := s.csrf.MatchFirst(doc)
+		if node == nil {
+			return errors.New("login page has no element matching " + s.login.CSRFSelector)
+		}
+
+		field := s.login.CSRFField
+		if field == "" {
+			field = htmlAttr(node, "name")
+		}
+		if field == "" {
+			return errors.New("login requires a csrfField for " + s.login.CSRFSelector)
+		}
+		token := htmlAttr(node, "value")
+		if node.Data == "meta" {
+			token = htmlAttr(node, "content")
+		}
+		fields.Set(field, token)
+
+		// post to the form holding the token unless an action is configured
+		for p := node.Parent; p != nil; p = p.Parent {
+			if p.Type == html.ElementNode && p.Data == "form" {
+				if ref := htmlAttr(p, "action"); ref != "" {
+					if u, err := fixedURL(action, ref); err == nil {
+						action = u
+					}
+				}
+				break
+			}
+		}
+	}
+
+	if s.login.Action != "" {
+		if action, err = fixedURL(resp.Request.URL, s.login.Action); err != nil {
+			return err
+		}
+	}
+
+	req, err = createRequest(http.MethodPost, action.String(), crawler.config.UserAgent, strings.NewReader(fields.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", resp.Request.URL.String())
+
+	result, err := crawler.fetch(req)
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	body, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		return err
+	}
+
+	switch finalURL := result.Request.URL.String(); {
+	case s.login.SuccessStatus != 0 && result.StatusCode != s.login.SuccessStatus,
+		s.login.SuccessStatus == 0 && (result.StatusCode < 200 || result.StatusCode > 299):
+		return errors.New("login failed, status text: " + http.StatusText(result.StatusCode))
+	case s.successRedirect != nil && !s.successRedirect.MatchString(finalURL):
+		return errors.New("login failed, redirected to " + finalURL)
+	case s.login.SuccessText != "" && !bytes.Contains(body, []byte(s.login.SuccessText)):
+		return errors.New("login failed, response doesn't contain the success text")
+	}
+
+	crawler.Logger.Printf("URL: %s, logged in\n", action.String())
+	return nil
+}
+
+// loggedOut reports whether resp matches a logged out condition, the body of an
+// HTML response is buffered to look for the logged out text
+func (s *session) loggedOut(resp *http.Response) bool {
+	if s.login.LoggedOutStatus != 0 && resp.StatusCode == s.login.LoggedOutStatus {
+		return true
+	}
+	if s.loggedOutRedirect != nil && resp.Request != nil && s.loggedOutRedirect.MatchString(resp.Request.URL.String()) {
+		return true
+	}
+
+	if s.login.LoggedOutText == "" {
+		return false
+	}
+	if MIME, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); MIME != "text/html" {
+		return false
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return err == nil && bytes.Contains(body, []byte(s.login.LoggedOutText))
+}
+
+// relogin logs in again unless another request already did since generation gen
+func (crawler *Crawler) relogin(gen int) error {
+	s := crawler.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gen != gen {
+		return nil
+	}
+	crawler.Logger.Println("Logged out, logging in again")
+	return crawler.login()
+}
+
+func (s *session) generation() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gen
+}
+
+func htmlAttr(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+package crawl
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Srcset candidates to download
+const (
+	SrcsetLargest = "largest"
+	SrcsetAll     = "all"
+)
+
+const srcsetSpace = " \t\n\r\f"
+
+// ValidSrcset reports whether srcset is a supported srcset candidate selection
+func ValidSrcset(srcset string) bool {
+	switch srcset {
+	case "", SrcsetLargest, SrcsetAll:
+		return true
+	}
+	return false
+}
+
+// srcsetCandidate is an image candidate of a srcset attribute, width is set by a
+// w descriptor and density by an x descriptor, 1x without descriptor
+type srcsetCandidate struct {
+	url     string
+	width   int
+	density float64
+}
+
+// parseSrcset parses the image candidates of a srcset attribute, candidates
+// with invalid descriptors are dropped
+func parseSrcset(srcset string) []*srcsetCandidate {
+	var candidates []*srcsetCandidate
+	s := srcset
+	for {
+		s = strings.TrimLeft(s, srcsetSpace+",")
+		if s == "" {
+			return candidates
+		}
+
+		end := strings.IndexAny(s, srcsetSpace)
+		if end == -1 {
+			end = len(s)
+		}
+		u := s[:end]
+		s = s[end:]
+
+		// a url ending with a comma has no descriptor, otherwise descriptors
+		// run up to the next comma outside parentheses
+		var descriptors string
+		if strings.HasSuffix(u, ",") {
+			u = strings.TrimRight(u, ",")
+		} else {
+			depth, i := 0, 0
+		loop:
+			for ; i < len(s); i++ {
+				switch s[i] {
+				case '(':
+					depth++
+				case ')':
+					if depth > 0 {
+						depth--
+					}
+				case ',':
+					if depth == 0 {
+						break loop
+					}
+				}
+			}
+			descriptors = s[:i]
+			s = s[i:]
+		}
+
+		if candidate, ok := newSrcsetCandidate(u, descriptors); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+}
+
+func newSrcsetCandidate(u, descriptors string) (*srcsetCandidate, bool) {
+	candidate := &srcsetCandidate{url: u}
+	for _, d := range strings.Fields(descriptors) {
+		n := d[:len(d)-1]
+		switch d[len(d)-1] {
+		case 'w':
+			width, err := strconv.Atoi(n)
+			if err != nil || width <= 0 || candidate.width != 0 || candidate.density != 0 {
+				return nil, false
+			}
+			candidate.width = width
+		case 'x':
+			density, err := strconv.ParseFloat(n, 64)
+			if err != nil || density < 0 || candidate.width != 0 || candidate.density != 0 {
+				return nil, false
+			}
+			candidate.density = density
+		case 'h':
+			// the future-compat height descriptor doesn't change the candidate
+		default:
+			return nil, false
+		}
+	}
+	if candidate.width == 0 && candidate.density == 0 {
+		candidate.density = 1
+	}
+	return candidate, u != ""
+}
+
+// largestCandidate returns the candidate of the largest width, or of the largest
+// pixel density if no candidate has a width, sizes only narrows which candidate
+// browsers pick for a viewport so it doesn't change the largest one
+func largestCandidate(candidates []*srcsetCandidate) *srcsetCandidate {
+	var largest *srcsetCandidate
+	for _, c := range candidates {
+		switch {
+		case largest == nil:
+			largest = c
+		case c.width != 0 || largest.width != 0:
+			if c.width > largest.width {
+				largest = c
+			}
+		case c.density > largest.density:
+			largest = c
+		}
+	}
+	return largest
+}
+
+// srcsetRefs returns the urls of srcset to download, all of them or the largest one
+func (crawler *Crawler) srcsetRefs(srcset string) []string {
+	candidates := parseSrcset(srcset)
+	if len(candidates) == 0 {
+		return nil
+	}
+	if crawler.config.Option.Srcset != SrcsetAll {
+		candidates = []*srcsetCandidate{largestCandidate(candidates)}
+	}
+
+	refs := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		refs = append(refs, c.url)
+	}
+	return refs
+}
+
+// assetRefs returns the urls of the files the attribute key of a tag refers to:
+// src of any element (img, script, video, audio, source, track, embed...),
+// srcset of img and picture source, video poster, object data and link href
+func (crawler *Crawler) assetRefs(tag, key, val string) []string {
+	switch {
+	case key == "src",
+		tag == "link" && key == "href",
+		tag == "video" && key == "poster",
+		tag == "object" && key == "data":
+		return []string{val}
+	case key == "srcset" && (tag == "img" || tag == "source"):
+		return crawler.srcsetRefs(val)
+	}
+	return nil
+}
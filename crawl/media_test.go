@@ -0,0 +1,95 @@
+package crawl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NzKSO/murphy/conf"
+)
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   []srcsetCandidate
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"a.jpg", []srcsetCandidate{{"a.jpg", 0, 1}}},
+		{"a.jpg 100w, b.jpg 200w", []srcsetCandidate{{"a.jpg", 100, 0}, {"b.jpg", 200, 0}}},
+		{"a.jpg 1x,b.jpg 2.5x", []srcsetCandidate{{"a.jpg", 0, 1}, {"b.jpg", 0, 2.5}}},
+		{"\ta.jpg\n100w ,\n b.jpg 2x ", []srcsetCandidate{{"a.jpg", 100, 0}, {"b.jpg", 0, 2}}},
+		// commas are part of the url up to the next whitespace
+		{"https://cdn.example.com/w_100,h_50/a.jpg 100w, https://cdn.example.com/w_200,h_100/a.jpg 200w",
+			[]srcsetCandidate{{"https://cdn.example.com/w_100,h_50/a.jpg", 100, 0}, {"https://cdn.example.com/w_200,h_100/a.jpg", 200, 0}}},
+		{"data:image/png;base64,AAAA 1x, b.jpg 2x", []srcsetCandidate{{"data:image/png;base64,AAAA", 0, 1}, {"b.jpg", 0, 2}}},
+		// a trailing comma ends a url without descriptor, any other comma is part of it
+		{"a.jpg, b.jpg 2x", []srcsetCandidate{{"a.jpg", 0, 1}, {"b.jpg", 0, 2}}},
+		{"a.jpg,b.jpg 2x", []srcsetCandidate{{"a.jpg,b.jpg", 0, 2}}},
+		{"a.jpg,, b.jpg", []srcsetCandidate{{"a.jpg", 0, 1}, {"b.jpg", 0, 1}}},
+		{"a.jpg 100w 50h", []srcsetCandidate{{"a.jpg", 100, 0}}},
+		// invalid descriptors drop the candidate
+		{"a.jpg 100q, b.jpg 0w, c.jpg 100w 2x, d.jpg -1x, e.jpg 2x", []srcsetCandidate{{"e.jpg", 0, 2}}},
+		{"a.jpg 100w (x, y), b.jpg 200w", []srcsetCandidate{{"b.jpg", 200, 0}}},
+	}
+
+	for _, tt := range tests {
+		var got []srcsetCandidate
+		for _, c := range parseSrcset(tt.srcset) {
+			got = append(got, *c)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSrcset(%q) = %v, want %v", tt.srcset, got, tt.want)
+		}
+	}
+}
+
+func TestLargestCandidate(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   string
+	}{
+		{"a.jpg 100w, b.jpg 800w, c.jpg 400w", "b.jpg"},
+		{"a.jpg, b.jpg 3x, c.jpg 2x", "b.jpg"},
+		{"a.jpg 2x, b.jpg 100w", "b.jpg"},
+		{"a.jpg 100w, b.jpg 2x", "a.jpg"},
+		{"a.jpg 100w, b.jpg 100w", "a.jpg"},
+		{"a.jpg", "a.jpg"},
+	}
+
+	for _, tt := range tests {
+		if got := largestCandidate(parseSrcset(tt.srcset)); got == nil || got.url != tt.want {
+			t.Errorf("largestCandidate(%q) = %v, want %s", tt.srcset, got, tt.want)
+		}
+	}
+}
+
+func TestAssetRefs(t *testing.T) {
+	tests := []struct {
+		srcset string
+		tag    string
+		key    string
+		val    string
+		want   []string
+	}{
+		{"", "img", "src", "a.jpg", []string{"a.jpg"}},
+		{"", "img", "srcset", "a.jpg 1x, b.jpg 2x", []string{"b.jpg"}},
+		{SrcsetLargest, "source", "srcset", "a.webp 100w, b.webp 200w", []string{"b.webp"}},
+		{SrcsetAll, "source", "srcset", "a.webp 100w, b.webp 200w", []string{"a.webp", "b.webp"}},
+		{"", "img", "sizes", "50vw", nil},
+		{"", "video", "poster", "p.jpg", []string{"p.jpg"}},
+		{"", "audio", "poster", "p.jpg", nil},
+		{"", "track", "src", "t.vtt", []string{"t.vtt"}},
+		{"", "embed", "src", "e.swf", []string{"e.swf"}},
+		{"", "object", "data", "o.pdf", []string{"o.pdf"}},
+		{"", "div", "data", "o.pdf", nil},
+		{"", "link", "href", "s.css", []string{"s.css"}},
+		{"", "a", "srcset", "a.jpg", nil},
+	}
+
+	for _, tt := range tests {
+		crawler := New(&conf.Configuration{Option: &conf.Option{Srcset: tt.srcset}})
+		if got := crawler.assetRefs(tt.tag, tt.key, tt.val); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("srcset %q: assetRefs(%q, %q, %q) = %v, want %v", tt.srcset, tt.tag, tt.key, tt.val, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package crawl
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/robertkrimen/otto"
+)
+
+// pacPrelude defines the PAC helper functions which don't need DNS
+const pacPrelude = `
+function isPlainHostName(host) {
+	return host.indexOf(".") < 0;
+}
+function dnsDomainIs(host, domain) {
+	host = host.toLowerCase();
+	domain = domain.toLowerCase();
+	return host.length >= domain.length && host.substring(host.length - domain.length) == domain;
+}
+function localHostOrDomainIs(host, hostdom) {
+	return host == hostdom || (host.indexOf(".") < 0 && hostdom.lastIndexOf(host + ".", 0) == 0);
+}
+function dnsDomainLevels(host) {
+	return host.split(".").length - 1;
+}
+function shExpMatch(str, shexp) {
+	shexp = shexp.replace(/[.+^${}()|[\]\\]/g, "\\$&").replace(/\*/g, ".*").replace(/\?/g, ".");
+	return new RegExp("^" + shexp + "$").test(str);
+}
+function convert_addr(ipchars) {
+	var bytes = ipchars.split(".");
+	return ((bytes[0] & 0xff) << 24) | ((bytes[1] & 0xff) << 16) | ((bytes[2] & 0xff) << 8) | (bytes[3] & 0xff);
+}
+function isInNet(ipaddr, pattern, maskstr) {
+	if (!/^\d+\.\d+\.\d+\.\d+$/.test(ipaddr)) {
+		ipaddr = dnsResolve(ipaddr);
+		if (ipaddr == null) {
+			return false;
+		}
+	}
+	var mask = convert_addr(maskstr);
+	return (convert_addr(ipaddr) & mask) == (convert_addr(pattern) & mask);
+}
+var pacDays = ["SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"];
+function weekdayRange(wd1, wd2, gmt) {
+	if (wd2 == "GMT") {
+		gmt = wd2;
+		wd2 = undefined;
+	}
+	var now = new Date();
+	var day = gmt == "GMT" ? now.getUTCDay() : now.getDay();
+	var d1 = pacDays.indexOf(wd1), d2 = wd2 === undefined ? d1 : pacDays.indexOf(wd2);
+	return d1 <= d2 ? day >= d1 && day <= d2 : day >= d1 || day <= d2;
+}
+function timeRange(h1, h2, gmt) {
+	if (h2 == "GMT") {
+		gmt = h2;
+		h2 = undefined;
+	}
+	var now = new Date();
+	var hour = gmt == "GMT" ? now.getUTCHours() : now.getHours();
+	if (h2 === undefined) {
+		h2 = h1;
+	}
+	return h1 <= h2 ? hour >= h1 && hour <= h2 : hour >= h1 || hour <= h2;
+}
+function dateRange() {
+	throw new Error("dateRange is not supported");
+}
+`
+
+// pacScript evaluates a proxy auto-config file, the JavaScript VM isn't safe
+// for concurrent use so calls are serialized
+type pacScript struct {
+	mu     sync.Mutex
+	vm     *otto.Otto
+	source string
+}
+
+func firstIPv4(host string) string {
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return ""
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.String()
+		}
+	}
+	return ""
+}
+
+func loadPAC(filename string) (*pacScript, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	vm := otto.New()
+	vm.Set("dnsResolve", func(call otto.FunctionCall) otto.Value {
+		if ip := firstIPv4(call.Argument(0).String()); ip != "" {
+			v, _ := otto.ToValue(ip)
+			return v
+		}
+		return otto.NullValue()
+	})
+	vm.Set("isResolvable", func(call otto.FunctionCall) otto.Value {
+		v, _ := otto.ToValue(firstIPv4(call.Argument(0).String()) != "")
+		return v
+	})
+	vm.Set("myIpAddress", func(call otto.FunctionCall) otto.Value {
+		ip := "127.0.0.1"
+		// no packet is sent, dialing UDP only selects the outbound address
+		if conn, err := net.Dial("udp4", "192.0.2.1:80"); err == nil {
+			ip = conn.LocalAddr().(*net.UDPAddr).IP.String()
+			conn.Close()
+		}
+		v, _ := otto.ToValue(ip)
+		return v
+	})
+
+	if _, err = vm.Run(pacPrelude); err != nil {
+		return nil, err
+	}
+	if _, err = vm.Run(string(data)); err != nil {
+		return nil, errors.New("PAC file " + filename + ": " + err.Error())
+	}
+	if fn, err := vm.Get("FindProxyForURL"); err != nil || !fn.IsFunction() {
+		return nil, errors.New("PAC file " + filename + " doesn't define FindProxyForURL")
+	}
+	return &pacScript{vm: vm, source: string(data)}, nil
+}
+
+// find returns the proxy the PAC file picks for u, nil means direct
+func (pac *pacScript) find(u *url.URL) (*url.URL, error) {
+	pac.mu.Lock()
+	result, err := pac.vm.Call("FindProxyForURL", nil, u.String(), strings.ToLower(u.Hostname()))
+	pac.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return parsePACResult(result.String())
+}
+
+// parsePACResult returns the first proxy of a PAC result supported by the transport, nil means direct
+func parsePACResult(result string) (*url.URL, error) {
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var scheme string
+		switch strings.ToUpper(fields[0]) {
+		case "DIRECT":
+			return nil, nil
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		default:
+			continue
+		}
+		if len(fields) == 2 {
+			return &url.URL{Scheme: scheme, Host: fields[1]}, nil
+		}
+	}
+	return nil, errors.New("no supported proxy in PAC result: " + result)
+}
+
+// pacEntry returns the PAC result entry of proxy u
+func pacEntry(u *url.URL) string {
+	if u == nil {
+		return "DIRECT"
+	}
+	switch u.Scheme {
+	case "https":
+		return "HTTPS " + u.Host
+	case "socks5":
+		return "SOCKS5 " + u.Host
+	default:
+		return "PROXY " + u.Host
+	}
+}
@@ -3,14 +3,13 @@ package crawl
 import (
 	"bufio"
 	"bytes"
-	"compress/flate"
-	"compress/gzip"
 	"errors"
 	"io"
 	"io/ioutil"
 	"mime"
 	"net/http"
 	"net/url"
+	"path"
 	"reflect"
 	"strings"
 
@@ -40,6 +39,22 @@ func (crawler *Crawler) parseHTML(rd io.Reader, urlTopo *URLTopological, dir str
 		rd = buf
 	}
 
+	if len(crawler.extractors) > 0 {
+		content, err := ioutil.ReadAll(rd)
+		if err != nil {
+			crawler.Logger.Printf("Reading error while parsing HTML: %v", err)
+			return
+		}
+
+		doc, err := html.Parse(bytes.NewReader(content))
+		if err != nil {
+			crawler.Logger.Printf("URL: %s, Error parsing HTML: %v\n", urlTopo.URL.String(), err)
+		} else {
+			crawler.extract(doc, urlTopo, dir)
+		}
+		rd = bytes.NewReader(content)
+	}
+
 	var (
 		depth int
 		tt    html.TokenType
@@ -56,7 +71,7 @@ func (crawler *Crawler) parseHTML(rd io.Reader, urlTopo *URLTopological, dir str
 			crawler.Logger.Printf("Error token while parsing HTML: %v", tz.Err())
 		case html.TextToken:
 			if crawler.DownloadHTML && depth > 0 {
-				if err = writeFile(bytes.NewReader(data), dir, string(tz.Text())+".html"); err != nil {
+				if err = crawler.writeFile(bytes.NewReader(data), dir, string(tz.Text())+".html"); err != nil {
 					crawler.Logger.Printf("Error writing file %s: %v", string(tz.Text())+".html", err)
 				}
 			}
@@ -75,93 +90,14 @@ func (crawler *Crawler) parseHTML(rd io.Reader, urlTopo *URLTopological, dir str
 				for {
 					key, val, more := tz.TagAttr()
 
-					if string(tn) == "a" && string(key) == "href" && (urlTopo.Depth > 1 || urlTopo.Depth == -1) {
-						if strings.HasPrefix(string(val), "javascript:") {
-							break
-						}
-
-						actualURL, err := fixedURL(urlTopo.URL, string(val))
-						if err != nil {
-							crawler.Logger.Printf("Error resolving ref url: %v\n", err)
-							break
-						}
-
-						if !crawler.config.Option.ExternalWebpages && actualURL.Hostname() != urlTopo.URL.Hostname() {
-							break
-						}
-
-						if actualURL.Fragment != "" {
-							actualURL.Fragment = ""
-						}
-
-						httpurl := actualURL.String()
-						if _, loaded := crawler.crawledURL.LoadOrStore(httpurl, true); !loaded {
-							crawler.Logger.Printf("Found new url %q on %s\n", httpurl, urlTopo.URL.String())
-							if urlTopo.Depth != -1 {
-								crawler.URLTopoCh <- &URLTopological{actualURL, urlTopo.Depth - 1}
-							} else {
-								crawler.URLTopoCh <- &URLTopological{actualURL, -1}
-							}
-						}
-						break
-					} else if string(key) == "src" || (string(tn) == "link" && string(key) == "href") {
-						if strings.HasPrefix(string(val), "data:") {
-							if err := writeBase64ImageFile(string(val), crawler.config.Dir); err != nil {
-								crawler.Logger.Printf("Error writing base64 image file: %v\n", err)
-							}
-							break
-						}
-
-						ext, idx, ok := containsAnyExts(string(val), crawler.config.FileTypes)
-						if !ok {
-							break
-						}
-
-						refurl := string(val[:idx+len(ext)])
-						actualURL, err := fixedURL(urlTopo.URL, refurl)
-						if err != nil {
-							crawler.Logger.Printf("Error resolving ref url: %v\n", err)
-							break
-						}
-
-						if actualURL.Fragment != "" {
-							actualURL.Fragment = ""
-						}
-
-						httpurl := actualURL.String()
-						if _, loaded := crawler.crawledURL.LoadOrStore(httpurl, true); loaded {
-							break
-						}
-
-						req, err := createRequest(http.MethodGet, httpurl, crawler.config.UserAgent, nil)
-						if err != nil {
-							crawler.Logger.Printf("URL: %s, createRequest error: %v\n", httpurl, err)
-							return
-						}
-
-						resp, err := crawler.client.Do(req)
-						if err != nil {
-							crawler.Logger.Printf("HTTP Error: %v\n", err)
-							break
-						}
-						defer resp.Body.Close()
-
-						if resp.StatusCode != http.StatusOK {
-							crawler.Logger.Printf("URL: %s, status text: %v\n", httpurl, http.StatusText(resp.StatusCode))
-							break
-						}
-
-						MIME, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
-						crawler.Logger.Printf("Found file %s on %v", getFileName(actualURL.Path, ext), httpurl)
-						if MIME != mime.TypeByExtension(ext) {
-							crawler.Logger.Printf("URL: %s, MIME type in Content-Type mismatch file extension name", actualURL.String())
-						}
-
-						if err = writeFile(resp.Body, dir, getFileName(actualURL.Path, ext)); err != nil {
-							crawler.Logger.Printf("Error writing file %s: %v", string(tz.Text())+".html", err)
-						}
+					if string(tn) == "a" && string(key) == "href" {
+						crawler.follow(urlTopo, string(val))
 						break
 					}
+					// media elements may refer to several files, e.g. <img src srcset>
+					for _, ref := range crawler.assetRefs(string(tn), string(key), string(val)) {
+						crawler.fetchAsset(urlTopo, ref, dir)
+					}
 					if !more {
 						break
 					}
@@ -171,20 +107,102 @@ func (crawler *Crawler) parseHTML(rd io.Reader, urlTopo *URLTopological, dir str
 	}
 }
 
-func uncompressBody(resp *http.Response) (io.ReadCloser, error) {
-	enc := resp.Header.Get("Content-Encoding")
-	switch enc {
-	case "gzip":
-		zr, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			return nil, err
+// follow enqueues the webpage ref links to from the webpage of urlTopo
+func (crawler *Crawler) follow(urlTopo *URLTopological, ref string) {
+	if (urlTopo.Depth <= 1 && urlTopo.Depth != -1) || strings.HasPrefix(ref, "javascript:") {
+		return
+	}
+
+	actualURL, err := fixedURL(urlTopo.URL, ref)
+	if err != nil {
+		crawler.Logger.Printf("Error resolving ref url: %v\n", err)
+		return
+	}
+
+	if !crawler.inScope(actualURL, urlTopo.Seed) {
+		return
+	}
+
+	if rule, ok := crawler.rejected(actualURL, TargetPage); ok {
+		crawler.Logger.Printf("URL: %s, rejected by filter %q\n", actualURL.String(), rule)
+		return
+	}
+
+	nextDepth := -1
+	if urlTopo.Depth != -1 {
+		nextDepth = urlTopo.Depth - 1
+	}
+	child := &URLTopological{URL: actualURL, Seed: urlTopo.Seed, Depth: nextDepth, Level: urlTopo.Level + 1}
+	if crawler.Enqueue(child) {
+		crawler.Logger.Printf("Found new url %q on %s\n", actualURL.String(), urlTopo.URL.String())
+	}
+}
+
+// fetchAsset downloads the file ref refers to if its extension is one of the file types
+func (crawler *Crawler) fetchAsset(urlTopo *URLTopological, ref, dir string) {
+	if strings.HasPrefix(ref, "data:") {
+		if err := writeBase64ImageFile(ref, crawler.config.Dir); err != nil {
+			crawler.Logger.Printf("Error writing base64 image file: %v\n", err)
 		}
-		return zr, nil
-	case "deflate":
-		dfr := flate.NewReader(resp.Body)
-		return dfr, nil
-	default:
-		return nil, errors.New("unknown Content-Encoding: " + enc)
+		return
+	}
+
+	ext, idx, ok := containsAnyExts(ref, crawler.config.FileTypes)
+	if !ok {
+		return
+	}
+
+	actualURL, err := fixedURL(urlTopo.URL, ref[:idx+len(ext)])
+	if err != nil {
+		crawler.Logger.Printf("Error resolving ref url: %v\n", err)
+		return
+	}
+	crawler.downloadAsset(urlTopo, actualURL, ext, dir)
+}
+
+// fetchRef downloads the file ref refers to whatever its extension
+func (crawler *Crawler) fetchRef(urlTopo *URLTopological, ref, dir string) {
+	if strings.HasPrefix(ref, "data:") {
+		crawler.fetchAsset(urlTopo, ref, dir)
+		return
+	}
+
+	actualURL, err := fixedURL(urlTopo.URL, ref)
+	if err != nil {
+		crawler.Logger.Printf("Error resolving ref url: %v\n", err)
+		return
+	}
+
+	ext, _, ok := containsAnyExts(actualURL.Path, crawler.config.FileTypes)
+	if !ok {
+		ext = path.Ext(actualURL.Path)
+	}
+	crawler.downloadAsset(urlTopo, actualURL, ext, dir)
+}
+
+func (crawler *Crawler) downloadAsset(urlTopo *URLTopological, actualURL *url.URL, ext, dir string) {
+	if rule, ok := crawler.rejected(actualURL, TargetAsset); ok {
+		crawler.Logger.Printf("URL: %s, rejected by filter %q\n", actualURL.String(), rule)
+		return
+	}
+
+	httpurl := actualURL.String()
+	if _, loaded := crawler.crawledURL.LoadOrStore(crawler.seenKey(actualURL), true); loaded {
+		return
+	}
+
+	if !crawler.allowedByRobots(actualURL) {
+		crawler.Logger.Printf("URL: %s, disallowed by robots.txt\n", httpurl)
+		return
+	}
+
+	fileName := getFileName(actualURL.Path, ext)
+	crawler.Logger.Printf("Found file %s on %v", fileName, httpurl)
+
+	if err := crawler.download(actualURL, urlTopo.Seed, dir, fileName, ext); err != nil {
+		crawler.Logger.Printf("URL: %s, error downloading file %s: %v\n", httpurl, fileName, err)
+	} else if crawler.Checkpoint != nil {
+		crawler.Checkpoint.Done(httpurl)
 	}
 }
 
@@ -194,7 +212,7 @@ func (crawler *Crawler) handleOctetStream(resp *http.Response, dir string) {
 		if v, ok := params["filename"]; ok && v != "" {
 			if _, _, ok := containsAnyExts(v, crawler.config.FileTypes); ok {
 				crawler.Logger.Printf("Found file %s on %v", params["filename"], resp.Request.URL.String())
-				if err = writeFile(resp.Body, dir, params["filename"]); err != nil {
+				if err = crawler.writeFile(resp.Body, dir, params["filename"]); err != nil {
 					crawler.Logger.Printf("Error writing file %s: %v", params["filename"], err)
 				}
 				return
@@ -204,7 +222,7 @@ func (crawler *Crawler) handleOctetStream(resp *http.Response, dir string) {
 	if resp.Request != nil {
 		path := resp.Request.URL.Path
 		if ext, _, ok := containsAnyExts(path, crawler.config.FileTypes); ok {
-			if err = writeFile(resp.Body, dir, getFileName(path, ext)); err != nil {
+			if err = crawler.writeFile(resp.Body, dir, getFileName(path, ext)); err != nil {
 				crawler.Logger.Printf("Error writing file %s: %v", params["filename"], err)
 			}
 		}
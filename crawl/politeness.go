@@ -0,0 +1,133 @@
+package crawl
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+type hostLimiter struct {
+	mu       sync.Mutex
+	slots    chan struct{}
+	interval time.Duration
+	next     time.Time
+}
+
+// politeness throttles requests on a per-host basis
+type politeness struct {
+	mu       sync.Mutex
+	hosts    map[string]*hostLimiter
+	interval time.Duration
+	maxCon   int
+}
+
+func newPoliteness(rate float64, delay time.Duration, maxCon int) *politeness {
+	interval := delay
+	if rate > 0 {
+		if d := time.Duration(float64(time.Second) / rate); d > interval {
+			interval = d
+		}
+	}
+	return &politeness{
+		hosts:    make(map[string]*hostLimiter),
+		interval: interval,
+		maxCon:   maxCon,
+	}
+}
+
+func (p *politeness) limiter(host string) *hostLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hl, ok := p.hosts[host]
+	if !ok {
+		hl = &hostLimiter{interval: p.interval}
+		if p.maxCon > 0 {
+			hl.slots = make(chan struct{}, p.maxCon)
+		}
+		p.hosts[host] = hl
+	}
+	return hl
+}
+
+// setDelay raises the minimum delay between two requests to host
+func (p *politeness) setDelay(host string, delay time.Duration) {
+	hl := p.limiter(host)
+	hl.mu.Lock()
+	if delay > hl.interval {
+		hl.interval = delay
+	}
+	hl.mu.Unlock()
+}
+
+// acquire blocks until a request to host is allowed or ctx is done, the returned
+// function must be called once the request is finished
+func (p *politeness) acquire(ctx context.Context, host string) (func(), error) {
+	hl := p.limiter(host)
+	if hl.slots != nil {
+		select {
+		case hl.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			if hl.slots != nil {
+				<-hl.slots
+			}
+		})
+	}
+
+	hl.mu.Lock()
+	now := time.Now()
+	if hl.next.Before(now) {
+		hl.next = now
+	}
+	wait := hl.next.Sub(now)
+	hl.next = hl.next.Add(hl.interval)
+	hl.mu.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// hostSlot is the host slot held by a request, it's carried by the request context
+type hostSlot struct {
+	host    string
+	release func()
+}
+
+type hostSlotKey struct{}
+
+// releaseBody releases the host slot held by a response once its body is drained or closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (rb *releaseBody) Read(p []byte) (int, error) {
+	n, err := rb.ReadCloser.Read(p)
+	if err != nil {
+		rb.release()
+	}
+	return n, err
+}
+
+func (rb *releaseBody) Close() error {
+	err := rb.ReadCloser.Close()
+	rb.release()
+	return err
+}
@@ -0,0 +1,116 @@
+package crawl
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NzKSO/murphy/conf"
+)
+
+// Profile rotation strategies
+const (
+	RotatePerRequest = "request"
+	RotatePerHost    = "host"
+	RotatePerSession = "session"
+)
+
+// defaultProfile is used when no profile is configured
+var defaultProfile = conf.Profile{
+	Name:           "default",
+	UserAgent:      "Mozilla/5.0 (compatible; murphy; +https://github.com/NzKSO/murphy)",
+	Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+	AcceptLanguage: "en-US,en;q=0.9",
+}
+
+// ValidRotation reports whether rotation is a supported profile rotation strategy
+func ValidRotation(rotation string) bool {
+	switch rotation {
+	case "", RotatePerRequest, RotatePerHost, RotatePerSession:
+		return true
+	}
+	return false
+}
+
+// profiles picks the header profile of each request according to the rotation strategy
+type profiles struct {
+	list     []conf.Profile
+	rotation string
+	session  int
+	next     uint32
+	mu       sync.Mutex
+	hosts    map[string]int
+}
+
+func newProfiles(config *conf.Configuration) *profiles {
+	p := &profiles{
+		list:     append([]conf.Profile(nil), config.Profiles...),
+		rotation: config.Rotation,
+		hosts:    make(map[string]int),
+	}
+	if len(p.list) == 0 {
+		// the built-in profile identifies with the configured user agent if any
+		p.list = []conf.Profile{defaultProfile}
+		if config.UserAgent != "" {
+			p.list[0].UserAgent = config.UserAgent
+		}
+	}
+	for i := range p.list {
+		if p.list[i].UserAgent == "" {
+			p.list[i].UserAgent = config.UserAgent
+		}
+		if p.list[i].UserAgent == "" {
+			p.list[i].UserAgent = defaultProfile.UserAgent
+		}
+	}
+	if p.rotation == "" {
+		p.rotation = RotatePerSession
+	}
+
+	p.session = rand.New(rand.NewSource(time.Now().UnixNano())).Intn(len(p.list))
+	return p
+}
+
+// pick returns the profile to use for a request to host
+func (p *profiles) pick(host string) *conf.Profile {
+	switch p.rotation {
+	case RotatePerRequest:
+		n := atomic.AddUint32(&p.next, 1) - 1
+		return &p.list[int(n%uint32(len(p.list)))]
+	case RotatePerHost:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		i, ok := p.hosts[host]
+		if !ok {
+			i = (p.session + len(p.hosts)) % len(p.list)
+			p.hosts[host] = i
+		}
+		return &p.list[i]
+	default:
+		return &p.list[p.session]
+	}
+}
+
+// userAgent returns the user agent of the session profile, which robots.txt rules are matched against
+func (crawler *Crawler) userAgent() string {
+	return crawler.profiles.list[crawler.profiles.session].UserAgent
+}
+
+// identify sets the header fields of the profile picked for req
+func (crawler *Crawler) identify(req *http.Request) {
+	profile := crawler.profiles.pick(strings.ToLower(req.URL.Hostname()))
+
+	req.Header.Set("User-Agent", profile.UserAgent)
+	if profile.Accept != "" {
+		req.Header.Set("Accept", profile.Accept)
+	}
+	if profile.AcceptLanguage != "" {
+		req.Header.Set("Accept-Language", profile.AcceptLanguage)
+	}
+	for key, val := range profile.Headers {
+		req.Header.Set(key, val)
+	}
+}
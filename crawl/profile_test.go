@@ -0,0 +1,35 @@
+package crawl
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/NzKSO/murphy/conf"
+)
+
+func TestProfileUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		profiles  []conf.Profile
+		want      string
+	}{
+		{"", nil, defaultProfile.UserAgent},
+		{"mybot/1.0", nil, "mybot/1.0"},
+		{"mybot/1.0", []conf.Profile{{Name: "a"}}, "mybot/1.0"},
+		{"mybot/1.0", []conf.Profile{{Name: "a", UserAgent: "otherbot/2.0"}}, "otherbot/2.0"},
+		{"", []conf.Profile{{Name: "a"}}, defaultProfile.UserAgent},
+	}
+
+	for _, tt := range tests {
+		crawler := New(&conf.Configuration{UserAgent: tt.userAgent, Profiles: tt.profiles, Option: &conf.Option{}})
+		if got := crawler.userAgent(); got != tt.want {
+			t.Errorf("user agent %q, profiles %v: userAgent() = %q, want %q", tt.userAgent, tt.profiles, got, tt.want)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+		crawler.identify(req)
+		if got := req.Header.Get("User-Agent"); got != tt.want {
+			t.Errorf("user agent %q, profiles %v: identify set User-Agent %q, want %q", tt.userAgent, tt.profiles, got, tt.want)
+		}
+	}
+}
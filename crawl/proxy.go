@@ -0,0 +1,333 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NzKSO/murphy/conf"
+)
+
+// Proxy rotation strategies
+const (
+	ProxyRoundRobin = "roundRobin"
+	ProxyPerHost    = "host"
+)
+
+const (
+	defaultProxyMaxFailures   = 3
+	defaultProxyCheckInterval = 60
+	proxyCheckTimeout         = 10 * time.Second
+)
+
+var errNoProxy = errors.New("no healthy proxy left in the pool")
+
+// ValidProxyRotation reports whether rotation is a supported proxy rotation strategy
+func ValidProxyRotation(rotation string) bool {
+	switch rotation {
+	case "", ProxyRoundRobin, ProxyPerHost:
+		return true
+	}
+	return false
+}
+
+// ValidProxyProtocol reports whether protocol is a supported proxy protocol
+func ValidProxyProtocol(protocol string) bool {
+	switch protocol {
+	case "http", "https", "socks5":
+		return true
+	}
+	return false
+}
+
+// ProxyStat holds the statistics of a proxy of the pool
+type ProxyStat struct {
+	URL      string
+	Requests int
+	Failures int
+	Evicted  bool
+}
+
+type proxyEntry struct {
+	url         *url.URL
+	requests    int
+	failures    int
+	consecutive int
+	evicted     bool
+	evictedAt   time.Time
+}
+
+// proxyChoice records the proxy picked for a request, it's carried by the request context
+type proxyChoice struct {
+	entry *proxyEntry
+}
+
+type proxyChoiceKey struct{}
+
+type proxyPool struct {
+	mu          sync.Mutex
+	entries     []*proxyEntry
+	rotation    string
+	next        int
+	hosts       map[string]*proxyEntry
+	maxFailures int
+	checked     bool
+	cooldown    time.Duration
+}
+
+// pick returns the next healthy proxy for host according to the rotation strategy
+func (pool *proxyPool) pick(host string) (*proxyEntry, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.revive()
+
+	if pool.rotation == ProxyPerHost {
+		if entry, ok := pool.hosts[host]; ok && !entry.evicted {
+			return entry, nil
+		}
+	}
+
+	for i := 0; i < len(pool.entries); i++ {
+		entry := pool.entries[pool.next]
+		pool.next = (pool.next + 1) % len(pool.entries)
+		if !entry.evicted {
+			if pool.rotation == ProxyPerHost {
+				pool.hosts[host] = entry
+			}
+			return entry, nil
+		}
+	}
+	return nil, errNoProxy
+}
+
+// live returns the number of proxies not evicted, pool.mu must be held
+func (pool *proxyPool) live() int {
+	var n int
+	for _, entry := range pool.entries {
+		if !entry.evicted {
+			n++
+		}
+	}
+	return n
+}
+
+// revive brings back the proxies evicted for longer than the cooldown when there
+// is no health check to do it, pool.mu must be held
+func (pool *proxyPool) revive() {
+	if pool.checked {
+		return
+	}
+	for _, entry := range pool.entries {
+		if entry.evicted && time.Since(entry.evictedAt) >= pool.cooldown {
+			entry.evicted = false
+			entry.consecutive = 0
+		}
+	}
+}
+
+// report records the outcome of a request sent through entry and reports whether
+// the proxy has just been evicted, the last healthy proxy is never evicted
+func (pool *proxyPool) report(entry *proxyEntry, failed bool) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	entry.requests++
+	if !failed {
+		entry.consecutive = 0
+		return false
+	}
+
+	entry.failures++
+	entry.consecutive++
+	if !entry.evicted && entry.consecutive >= pool.maxFailures && pool.live() > 1 {
+		entry.evicted = true
+		entry.evictedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// setHealth marks entry healthy or evicted after a health check and reports whether
+// it changed, the last healthy proxy is kept
+func (pool *proxyPool) setHealth(entry *proxyEntry, healthy bool) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if healthy {
+		entry.consecutive = 0
+	}
+	if entry.evicted == !healthy || (!healthy && pool.live() == 1) {
+		return false
+	}
+	entry.evicted = !healthy
+	entry.evictedAt = time.Now()
+	return true
+}
+
+// SetProxies spreads requests over proxies according to poolConf and starts
+// the health checks, which stop when the crawl is aborted
+func (crawler *Crawler) SetProxies(proxies []conf.Proxy, poolConf conf.ProxyPool) error {
+	if !ValidProxyRotation(poolConf.Rotation) {
+		return errors.New("invalid proxy rotation: " + poolConf.Rotation)
+	}
+
+	pool := &proxyPool{
+		rotation:    poolConf.Rotation,
+		hosts:       make(map[string]*proxyEntry),
+		maxFailures: poolConf.MaxFailures,
+		checked:     poolConf.CheckURL != "",
+	}
+	if pool.maxFailures <= 0 {
+		pool.maxFailures = defaultProxyMaxFailures
+	}
+	interval := poolConf.CheckInterval
+	if interval <= 0 {
+		interval = defaultProxyCheckInterval
+	}
+	// without health check, evicted proxies are back after a check interval
+	pool.cooldown = time.Duration(interval) * time.Second
+
+	for _, proxy := range proxies {
+		if !ValidProxyProtocol(proxy.Protocol) {
+			return errors.New("unsupported proxy protocol: " + proxy.Protocol)
+		}
+		password, err := resolveSecret(proxy.Password)
+		if err != nil {
+			return err
+		}
+		proxy.Password = password
+		pool.entries = append(pool.entries, &proxyEntry{url: proxy.URL()})
+	}
+	if len(pool.entries) == 0 {
+		return errors.New("proxy pool is empty")
+	}
+
+	crawler.proxies = pool
+	crawler.SetProxy(crawler.poolProxy)
+
+	if poolConf.CheckURL != "" {
+		go crawler.checkProxies(poolConf.CheckURL, pool.cooldown)
+	}
+	return nil
+}
+
+// poolProxy is the proxy function of the transports when a proxy pool is set
+func (crawler *Crawler) poolProxy(req *http.Request) (*url.URL, error) {
+	entry, err := crawler.proxies.pick(strings.ToLower(req.URL.Hostname()))
+	if err != nil {
+		return nil, err
+	}
+	if choice, ok := req.Context().Value(proxyChoiceKey{}).(*proxyChoice); ok {
+		choice.entry = entry
+	}
+	return entry.url, nil
+}
+
+// withProxyChoice returns req with a context recording the proxy it's sent through
+func (crawler *Crawler) withProxyChoice(req *http.Request) (*http.Request, *proxyChoice) {
+	if crawler.proxies == nil {
+		return req, nil
+	}
+	choice := &proxyChoice{}
+	return req.WithContext(context.WithValue(req.Context(), proxyChoiceKey{}, choice)), choice
+}
+
+// proxyFailed reports whether err comes from the proxy rather than from the origin
+// server: connecting to the proxy failed or the proxy refused the credentials
+func proxyFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "proxyconnect" {
+		return true
+	}
+	// the transport reports a refused CONNECT by the status text only
+	return strings.HasSuffix(err.Error(), ": "+http.StatusText(http.StatusProxyAuthRequired))
+}
+
+// reportProxy records the outcome of a request sent through the proxy of choice
+func (crawler *Crawler) reportProxy(choice *proxyChoice, resp *http.Response, err error) {
+	if choice == nil || choice.entry == nil {
+		return
+	}
+	if err != nil && crawler.ctx.Err() != nil {
+		return
+	}
+
+	failed := proxyFailed(err) || (resp != nil && resp.StatusCode == http.StatusProxyAuthRequired)
+	if crawler.proxies.report(choice.entry, failed) {
+		crawler.Logger.Printf("Proxy: %s, evicted after %d consecutive failures\n", choice.entry.url.Redacted(), crawler.proxies.maxFailures)
+	}
+}
+
+func (crawler *Crawler) checkProxies(checkURL string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-crawler.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, entry := range crawler.proxies.entries {
+			healthy := crawler.checkProxy(entry, checkURL)
+			if crawler.proxies.setHealth(entry, healthy) {
+				if healthy {
+					crawler.Logger.Printf("Proxy: %s, healthy again, back in the pool\n", entry.url.Redacted())
+				} else {
+					crawler.Logger.Printf("Proxy: %s, health check failed, evicted\n", entry.url.Redacted())
+				}
+			}
+		}
+	}
+}
+
+// checkProxy reports whether checkURL can be fetched through the proxy of entry
+func (crawler *Crawler) checkProxy(entry *proxyEntry, checkURL string) bool {
+	transport := crawler.transport.Clone()
+	transport.Proxy = http.ProxyURL(entry.url)
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{Transport: transport, Timeout: proxyCheckTimeout}
+	req, err := http.NewRequest(http.MethodGet, checkURL, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req.WithContext(crawler.ctx))
+	if err != nil {
+		return false
+	}
+	discardBody(resp)
+	return resp.StatusCode < 500 && resp.StatusCode != http.StatusProxyAuthRequired
+}
+
+// ProxyStats returns the statistics of each proxy of the pool, credentials are redacted
+func (crawler *Crawler) ProxyStats() []ProxyStat {
+	if crawler.proxies == nil {
+		return nil
+	}
+
+	pool := crawler.proxies
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	stats := make([]ProxyStat, 0, len(pool.entries))
+	for _, entry := range pool.entries {
+		stats = append(stats, ProxyStat{
+			URL:      entry.url.Redacted(),
+			Requests: entry.requests,
+			Failures: entry.failures,
+			Evicted:  entry.evicted,
+		})
+	}
+	return stats
+}
@@ -0,0 +1,55 @@
+package crawl
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestProxyPoolWithoutCheck(t *testing.T) {
+	a, _ := url.Parse("http://a.example.com:8080")
+	b, _ := url.Parse("http://b.example.com:8080")
+	pool := &proxyPool{
+		entries:     []*proxyEntry{{url: a}, {url: b}},
+		hosts:       make(map[string]*proxyEntry),
+		maxFailures: 2,
+		cooldown:    time.Hour,
+	}
+	first, second := pool.entries[0], pool.entries[1]
+
+	if pool.report(first, true) {
+		t.Fatal("proxy evicted after 1 failure, want 2")
+	}
+	if !pool.report(first, true) {
+		t.Fatal("proxy not evicted after 2 consecutive failures")
+	}
+	for i := 0; i < 3; i++ {
+		if entry, err := pool.pick("example.com"); err != nil || entry != second {
+			t.Fatalf("pick() = %v, %v, want the remaining proxy", entry, err)
+		}
+	}
+
+	// the last healthy proxy is kept
+	for i := 0; i < 3; i++ {
+		if pool.report(second, true) {
+			t.Fatal("last healthy proxy evicted")
+		}
+	}
+	if entry, err := pool.pick("example.com"); err != nil || entry != second {
+		t.Fatalf("pick() = %v, %v, want the last healthy proxy", entry, err)
+	}
+
+	// evicted proxies are back after the cooldown
+	first.evictedAt = time.Now().Add(-pool.cooldown)
+	picked := make(map[*proxyEntry]bool)
+	for i := 0; i < 2; i++ {
+		entry, err := pool.pick("example.com")
+		if err != nil {
+			t.Fatalf("pick(): %v", err)
+		}
+		picked[entry] = true
+	}
+	if !picked[first] || first.evicted {
+		t.Error("evicted proxy not back in the pool after the cooldown")
+	}
+}
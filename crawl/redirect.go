@@ -0,0 +1,160 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redirect policies, deciding where the redirects of webpages and assets may lead
+const (
+	RedirectAny    = "any"
+	RedirectScope  = "scope"
+	RedirectAssets = "assets"
+)
+
+// ValidRedirectPolicy reports whether policy is a supported redirect policy
+func ValidRedirectPolicy(policy string) bool {
+	switch policy {
+	case "", RedirectAny, RedirectScope, RedirectAssets:
+		return true
+	}
+	return false
+}
+
+func (crawler *Crawler) redirectPolicy() string {
+	if crawler.config.Option.Redirects != "" {
+		return crawler.config.Option.Redirects
+	}
+	return RedirectAssets
+}
+
+// redirectChain records the hops of the redirects followed by a webpage or an
+// asset request, it's carried by the request context
+type redirectChain struct {
+	target string
+	seed   *url.URL
+	hops   []*url.URL
+}
+
+type redirectChainKey struct{}
+
+// withRedirectChain returns req with a context recording its redirects, which
+// are checked against the scope of seed
+func (crawler *Crawler) withRedirectChain(req *http.Request, target string, seed *url.URL) (*http.Request, *redirectChain) {
+	chain := &redirectChain{target: target, seed: seed}
+	return req.WithContext(context.WithValue(crawler.ctx, redirectChainKey{}, chain)), chain
+}
+
+// checkRedirect stops following redirects after the maximum number of redirects,
+// redirects of webpages and assets must also satisfy the filters, the redirect policy
+// and robots.txt, each hop only carries the auth header fields of its own URL and
+// waits for the politeness limits of its host
+func (crawler *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	crawler.reauthorize(req)
+
+	chain, ok := req.Context().Value(redirectChainKey{}).(*redirectChain)
+	if ok {
+		// via[0] is the original request, hops are rebuilt as a retried request starts over
+		chain.hops = chain.hops[:0]
+		for _, r := range via[1:] {
+			chain.hops = append(chain.hops, r.URL)
+		}
+		chain.hops = append(chain.hops, req.URL)
+	}
+
+	max := crawler.config.Option.MaxRedirects
+	if max == 0 {
+		max = defaultMaxRedirects
+	}
+	if len(via) > max {
+		return fmt.Errorf("stopped after %d redirects: %w", max, errRedirectPolicy)
+	}
+
+	if ok {
+		if err := crawler.checkHop(req.URL, chain); err != nil {
+			return err
+		}
+	}
+	return crawler.moveSlot(req)
+}
+
+// checkHop checks a redirect hop of a webpage or an asset against the filters,
+// the redirect policy and the robots.txt of its host
+func (crawler *Crawler) checkHop(u *url.URL, chain *redirectChain) error {
+	if rule, rejected := crawler.rejected(u, chain.target); rejected {
+		return fmt.Errorf("redirect to %s rejected by filter %q: %w", u, rule, errRedirectPolicy)
+	}
+
+	policy := crawler.redirectPolicy()
+	if policy == RedirectScope || (policy == RedirectAssets && chain.target == TargetPage) {
+		if !crawler.inScope(u, chain.seed) {
+			return fmt.Errorf("redirect to %s out of scope: %w", u, errRedirectPolicy)
+		}
+	}
+
+	if !crawler.allowedByRobots(u) {
+		return fmt.Errorf("redirect to %s disallowed by robots.txt: %w", u, errRedirectPolicy)
+	}
+	return nil
+}
+
+// moveSlot releases the host slot of the previous request of a redirect and
+// waits for a slot of the host of req, so that each hop respects the limits of its host
+func (crawler *Crawler) moveSlot(req *http.Request) error {
+	slot, ok := req.Context().Value(hostSlotKey{}).(*hostSlot)
+	if !ok || slot.host == req.URL.Host {
+		return nil
+	}
+
+	slot.release()
+	release, err := crawler.politeness.acquire(req.Context(), req.URL.Host)
+	if err != nil {
+		// the slot is already released
+		slot.release = func() {}
+		return err
+	}
+	slot.host, slot.release = req.URL.Host, release
+	return nil
+}
+
+// redirected logs the hops of chain followed from u and marks them as seen, it
+// returns the final url, nil if there was no redirect, and whether it had been
+// seen before
+func (crawler *Crawler) redirected(u *url.URL, chain *redirectChain) (*url.URL, bool) {
+	if len(chain.hops) == 0 {
+		return nil, false
+	}
+
+	hops := make([]string, 0, len(chain.hops)+1)
+	hops = append(hops, u.Redacted())
+	var seen bool
+	for _, hop := range chain.hops {
+		hops = append(hops, hop.Redacted())
+		_, seen = crawler.crawledURL.LoadOrStore(crawler.seenKey(hop), true)
+	}
+	crawler.Logger.Printf("URL: %s, followed %d redirects: %s\n", u.Redacted(), len(chain.hops), strings.Join(hops, " -> "))
+
+	final := chain.hops[len(chain.hops)-1]
+	if crawler.seenKey(final) == crawler.seenKey(u) {
+		return nil, false
+	}
+	return final, seen
+}
+
+// redirectedPage returns urlTopo at the url it redirected to, it reports false
+// if that url has already been crawled
+func (crawler *Crawler) redirectedPage(urlTopo *URLTopological, chain *redirectChain) (*URLTopological, bool) {
+	rooturl := urlTopo.URL.String()
+	final, seen := crawler.redirected(urlTopo.URL, chain)
+	if final == nil {
+		return urlTopo, true
+	}
+	if seen {
+		crawler.Logger.Printf("URL: %s, redirected to %s which has already been crawled\n", rooturl, final.String())
+		return urlTopo, false
+	}
+	return &URLTopological{URL: final, Seed: urlTopo.Seed, Depth: urlTopo.Depth, Level: urlTopo.Level, Score: urlTopo.Score}, true
+}
@@ -0,0 +1,100 @@
+package crawl
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff     = time.Minute
+	maxRetryAfter       = 5 * time.Minute
+)
+
+// retryable reports whether a request of method that ended with resp and err is
+// worth retrying, non-idempotent requests such as a login form are sent once
+func (crawler *Crawler) retryable(method string, resp *http.Response, err error) bool {
+	switch method {
+	case http.MethodPost, http.MethodPatch:
+		return false
+	}
+	if err != nil {
+		return crawler.ctx.Err() == nil && !errors.Is(err, errRedirectPolicy)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return resp.StatusCode >= 500
+}
+
+// retryAfter parses the Retry-After header, either delay-seconds or an HTTP-date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	val := resp.Header.Get("Retry-After")
+	if val == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(val); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// backoff returns a jittered exponential delay before retry number attempt+1
+func (crawler *Crawler) backoff(attempt int) time.Duration {
+	base := time.Duration(crawler.config.Option.RetryBackoff) * time.Millisecond
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+
+	d := base << uint(attempt)
+	if d <= 0 || d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d, it returns false if the crawler is aborted meanwhile
+func (crawler *Crawler) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-crawler.ctx.Done():
+		return false
+	}
+}
+
+func discardBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
+
+// Retried returns the retried URLs with the number of attempts made for each of them
+func (crawler *Crawler) Retried() map[string]int {
+	attempts := make(map[string]int)
+	crawler.retried.Range(func(k, v interface{}) bool {
+		attempts[k.(string)] = v.(int)
+		return true
+	})
+	return attempts
+}
@@ -0,0 +1,235 @@
+package crawl
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRobotsSize = 512 * 1024
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robots holds the robots.txt rules that apply to the configured user agent
+type robots struct {
+	rules    []robotsRule
+	delay    time.Duration
+	sitemaps []string
+	deny     bool
+}
+
+type robotsEntry struct {
+	once   sync.Once
+	robots *robots
+}
+
+type robotsCache struct {
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{hosts: make(map[string]*robotsEntry)}
+}
+
+func (rc *robotsCache) entry(key string) *robotsEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	e, ok := rc.hosts[key]
+	if !ok {
+		e = new(robotsEntry)
+		rc.hosts[key] = e
+	}
+	return e
+}
+
+// robotsFor returns the robots.txt rules of the host of u, fetching them on first use
+func (crawler *Crawler) robotsFor(u *url.URL) *robots {
+	key := u.Scheme + "://" + u.Host
+	e := crawler.robots.entry(key)
+	e.once.Do(func() {
+		e.robots = crawler.fetchRobots(key)
+		if e.robots.delay > 0 {
+			crawler.politeness.setDelay(u.Host, e.robots.delay)
+		}
+	})
+	return e.robots
+}
+
+func (crawler *Crawler) fetchRobots(root string) *robots {
+	rawurl := root + "/robots.txt"
+	req, err := createRequest(http.MethodGet, rawurl, crawler.config.UserAgent, nil)
+	if err != nil {
+		crawler.Logger.Printf("URL: %s, createRequest error: %v\n", rawurl, err)
+		return &robots{}
+	}
+
+	resp, err := crawler.do(req)
+	if err != nil {
+		crawler.Logger.Printf("URL: %s, robots.txt unreachable, assuming full disallow: %v\n", rawurl, err)
+		return &robots{deny: true}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		crawler.Logger.Printf("URL: %s, status text: %v, assuming full disallow\n", rawurl, http.StatusText(resp.StatusCode))
+		return &robots{deny: true}
+	case resp.StatusCode != http.StatusOK:
+		return &robots{}
+	}
+
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsSize), crawler.userAgent())
+}
+
+// parseRobots parses robots.txt content and keeps the group that best matches userAgent
+func parseRobots(rd io.Reader, userAgent string) *robots {
+	type group struct {
+		agents []string
+		rules  []robotsRule
+		delay  time.Duration
+	}
+
+	var (
+		groups   []*group
+		cur      *group
+		inAgents bool
+		sitemaps []string
+	)
+
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx != -1 {
+			line = line[:idx]
+		}
+		colonIdx := strings.IndexByte(line, ':')
+		if colonIdx == -1 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colonIdx]))
+		val := strings.TrimSpace(line[colonIdx+1:])
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				cur = new(group)
+				groups = append(groups, cur)
+				inAgents = true
+			}
+			cur.agents = append(cur.agents, strings.ToLower(val))
+		case "allow", "disallow":
+			inAgents = false
+			if cur == nil || val == "" {
+				continue
+			}
+			cur.rules = append(cur.rules, robotsRule{key == "allow", val})
+		case "crawl-delay":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			if secs, err := strconv.ParseFloat(val, 64); err == nil && secs > 0 {
+				cur.delay = time.Duration(secs * float64(time.Second))
+			}
+		case "sitemap":
+			sitemaps = append(sitemaps, val)
+		default:
+			inAgents = false
+		}
+	}
+
+	userAgent = strings.ToLower(userAgent)
+	var (
+		best    *group
+		bestLen = -1
+	)
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			switch {
+			case agent == "*":
+				if bestLen < 0 {
+					best, bestLen = g, 0
+				}
+			case userAgent != "" && strings.Contains(userAgent, agent) && len(agent) > bestLen:
+				best, bestLen = g, len(agent)
+			}
+		}
+	}
+
+	rb := &robots{sitemaps: sitemaps}
+	if best != nil {
+		rb.rules = best.rules
+		rb.delay = best.delay
+	}
+	return rb
+}
+
+// allowed reports whether u may be fetched, the longest matching rule wins
+// and allow wins ties
+func (rb *robots) allowed(u *url.URL) bool {
+	if rb.deny {
+		return false
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allow, matchLen := true, -1
+	for _, rule := range rb.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		if n := len(rule.pattern); n > matchLen || (n == matchLen && rule.allow) {
+			allow, matchLen = rule.allow, n
+		}
+	}
+	return allow
+}
+
+// matchRobotsPattern matches path against a robots.txt pattern supporting '*' and a trailing '$'
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx == -1 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+	return !anchored || pos == len(path)
+}
+
+// allowedByRobots reports whether robots.txt permits crawling u
+func (crawler *Crawler) allowedByRobots(u *url.URL) bool {
+	if crawler.config.Option.IgnoreRobots {
+		return true
+	}
+	return crawler.robotsFor(u).allowed(u)
+}
@@ -0,0 +1,127 @@
+package crawl
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchRobotsPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/", true},
+		{"/private", "/private/a", true},
+		{"/private", "/privately", true},
+		{"/private/", "/private", false},
+		{"/a", "/b/a", false},
+		{"*", "/anything", true},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/dir/index.php?x=1", true},
+		{"/*.php", "/index.html", false},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/*.php$", "/a.php/b.php", true},
+		{"/*.php$", "/a.php/b", false},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"/a*$", "/abc", true},
+		{"/a*b*c", "/aXbYc", true},
+		{"/a*b*c", "/aXcYb", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchRobotsPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchRobotsPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+const testRobots = `# comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Crawl-delay: 2
+
+User-agent: murphy
+User-agent: otherbot
+Disallow: /murphy-only # trailing comment
+Allow: /page
+Disallow: /page
+Disallow:
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		path      string
+		want      bool
+	}{
+		{"somebot", "/", true},
+		{"somebot", "/private", false},
+		{"somebot", "/private/a", false},
+		{"somebot", "/private/public/a", true},
+		{"somebot", "/doc.pdf", false},
+		{"somebot", "/doc.pdf?dl=1", true},
+		{"somebot", "/murphy-only", true},
+		{"Mozilla/5.0 (compatible; Murphy; +https://github.com/NzKSO/murphy)", "/murphy-only", false},
+		{"Mozilla/5.0 (compatible; Murphy; +https://github.com/NzKSO/murphy)", "/private", true},
+		{"Mozilla/5.0 (compatible; Murphy; +https://github.com/NzKSO/murphy)", "/page", true},
+		{"otherbot/1.0", "/murphy-only", false},
+		{"", "/private", false},
+	}
+
+	for _, tt := range tests {
+		rb := parseRobots(strings.NewReader(testRobots), tt.userAgent)
+		u, err := url.Parse("https://example.com" + tt.path)
+		if err != nil {
+			t.Fatalf("url.Parse(%q): %v", tt.path, err)
+		}
+		if got := rb.allowed(u); got != tt.want {
+			t.Errorf("user agent %q: allowed(%q) = %v, want %v", tt.userAgent, tt.path, got, tt.want)
+		}
+	}
+
+	rb := parseRobots(strings.NewReader(testRobots), "somebot")
+	if rb.delay != 2*time.Second {
+		t.Errorf("delay = %v, want %v", rb.delay, 2*time.Second)
+	}
+	if len(rb.sitemaps) != 1 || rb.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("sitemaps = %v", rb.sitemaps)
+	}
+	if rb = parseRobots(strings.NewReader(testRobots), "murphy"); rb.delay != 0 {
+		t.Errorf("delay of the murphy group = %v, want 0", rb.delay)
+	}
+}
+
+func TestRobotsLongestMatch(t *testing.T) {
+	tests := []struct {
+		robots string
+		path   string
+		want   bool
+	}{
+		{"User-agent: *\nDisallow: /\nAllow: /public", "/public/a", true},
+		{"User-agent: *\nAllow: /public\nDisallow: /", "/public/a", true},
+		{"User-agent: *\nAllow: /a\nDisallow: /a/b", "/a/b/c", false},
+		{"User-agent: *\nDisallow: /a\nAllow: /a", "/a", true},
+		{"User-agent: *\nDisallow: /*.gif$\nAllow: /images/*", "/images/x.gif", true},
+		{"User-agent: *\nDisallow: /images/*.gif$\nAllow: /images/", "/images/x.gif", false},
+		{"", "/anything", true},
+	}
+
+	for _, tt := range tests {
+		rb := parseRobots(strings.NewReader(tt.robots), "somebot")
+		u, _ := url.Parse("https://example.com" + tt.path)
+		if got := rb.allowed(u); got != tt.want {
+			t.Errorf("robots %q: allowed(%q) = %v, want %v", tt.robots, tt.path, got, tt.want)
+		}
+	}
+}
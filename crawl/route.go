@@ -0,0 +1,216 @@
+package crawl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/NzKSO/murphy/conf"
+)
+
+const proxyDirect = "direct"
+
+type proxyRoute struct {
+	host  string
+	cidr  *net.IPNet
+	re    *regexp.Regexp
+	proxy *url.URL
+}
+
+// proxyRouter picks the proxy of a request from the first matching route, then
+// from the PAC file and finally from the fallback proxy function
+type proxyRouter struct {
+	routes   []*proxyRoute
+	pac      *pacScript
+	fallback func(*http.Request) (*url.URL, error)
+	resolved sync.Map
+}
+
+func parseRouteProxy(rawurl string) (*url.URL, error) {
+	if strings.EqualFold(rawurl, proxyDirect) {
+		return nil, nil
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if !ValidProxyProtocol(u.Scheme) || u.Host == "" {
+		return nil, errors.New("unsupported proxy: " + u.Redacted())
+	}
+	if password, ok := u.User.Password(); ok {
+		if password, err = resolveSecret(password); err != nil {
+			return nil, err
+		}
+		u.User = url.UserPassword(u.User.Username(), password)
+	}
+	return u, nil
+}
+
+func compileProxyRules(rules []conf.ProxyRule) ([]*proxyRoute, error) {
+	routes := make([]*proxyRoute, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Host == "" && rule.CIDR == "" && rule.Regex == "" {
+			return nil, errors.New("proxy rule requires a host, cidr or regex")
+		}
+
+		route := &proxyRoute{host: rule.Host}
+		var err error
+		if rule.CIDR != "" {
+			if _, route.cidr, err = net.ParseCIDR(rule.CIDR); err != nil {
+				return nil, err
+			}
+		}
+		if rule.Regex != "" {
+			if route.re, err = regexp.Compile(rule.Regex); err != nil {
+				return nil, err
+			}
+		}
+		if route.proxy, err = parseRouteProxy(rule.Proxy); err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// lookup returns the addresses of host, resolved once per host
+func (router *proxyRouter) lookup(host string) []net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+	if ips, ok := router.resolved.Load(host); ok {
+		return ips.([]net.IP)
+	}
+	ips, _ := net.LookupIP(host)
+	router.resolved.Store(host, ips)
+	return ips
+}
+
+func (router *proxyRouter) match(route *proxyRoute, u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if route.host != "" && !matchHost(host, route.host) {
+		return false
+	}
+	if route.re != nil && !route.re.MatchString(u.String()) {
+		return false
+	}
+	if route.cidr != nil {
+		for _, ip := range router.lookup(host) {
+			if route.cidr.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (router *proxyRouter) proxy(req *http.Request) (*url.URL, error) {
+	for _, route := range router.routes {
+		if router.match(route, req.URL) {
+			return route.proxy, nil
+		}
+	}
+
+	if router.pac != nil {
+		if u, err := router.pac.find(req.URL); err == nil {
+			return u, nil
+		}
+	}
+	return router.fallback(req)
+}
+
+// SetProxyRules routes requests by the ordered rules and then by the PAC file if
+// pacFile isn't empty, requests matching neither use the proxy set before
+func (crawler *Crawler) SetProxyRules(rules []conf.ProxyRule, pacFile string) error {
+	if len(rules) == 0 && pacFile == "" {
+		return nil
+	}
+
+	routes, err := compileProxyRules(rules)
+	if err != nil {
+		return err
+	}
+	router := &proxyRouter{routes: routes, fallback: crawler.transport.Proxy}
+	if router.fallback == nil {
+		router.fallback = http.ProxyFromEnvironment
+	}
+	if pacFile != "" {
+		if router.pac, err = loadPAC(pacFile); err != nil {
+			return err
+		}
+	}
+
+	crawler.router = router
+	crawler.SetProxy(router.proxy)
+	return nil
+}
+
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// ProxyPAC returns a PAC script equivalent to the proxy rules, the PAC file and
+// the proxy pool for the headless browser, it's empty if no rule or PAC file is set
+func (crawler *Crawler) ProxyPAC() string {
+	router := crawler.router
+	if router == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	if router.pac != nil {
+		fmt.Fprintf(&sb, "var userFindProxyForURL = (function () {\n%s\nreturn FindProxyForURL;\n})();\n\n", router.pac.source)
+	}
+
+	sb.WriteString("function FindProxyForURL(url, host) {\n\thost = host.toLowerCase();\n")
+	for _, route := range router.routes {
+		var conds []string
+		if route.host != "" {
+			pattern := strings.ToLower(route.host)
+			if strings.HasPrefix(pattern, "*.") {
+				pattern = pattern[1:]
+			}
+			if strings.HasPrefix(pattern, ".") {
+				conds = append(conds, fmt.Sprintf("(host == %s || dnsDomainIs(host, %s))", jsString(pattern[1:]), jsString(pattern)))
+			} else {
+				conds = append(conds, "host == "+jsString(pattern))
+			}
+		}
+		if route.re != nil {
+			conds = append(conds, fmt.Sprintf("new RegExp(%s).test(url)", jsString(route.re.String())))
+		}
+		if route.cidr != nil {
+			if ip4 := route.cidr.IP.To4(); ip4 != nil {
+				conds = append(conds, fmt.Sprintf("isInNet(host, %s, %s)", jsString(ip4.String()), jsString(net.IP(route.cidr.Mask).String())))
+			} else {
+				conds = append(conds, fmt.Sprintf("isInNetEx(dnsResolveEx(host), %s)", jsString(route.cidr.String())))
+			}
+		}
+		fmt.Fprintf(&sb, "\tif (%s) {\n\t\treturn %s;\n\t}\n", strings.Join(conds, " && "), jsString(pacEntry(route.proxy)))
+	}
+
+	if router.pac != nil {
+		sb.WriteString("\treturn userFindProxyForURL(url, host);\n}\n")
+		return sb.String()
+	}
+
+	fallback := "DIRECT"
+	if crawler.proxies != nil {
+		entries := make([]string, 0, len(crawler.proxies.entries))
+		for _, entry := range crawler.proxies.entries {
+			entries = append(entries, pacEntry(entry.url))
+		}
+		fallback = strings.Join(entries, "; ")
+	}
+	fmt.Fprintf(&sb, "\treturn %s;\n}\n", jsString(fallback))
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package crawl
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Crawl scopes, relative to the seed a webpage was discovered from
+const (
+	ScopeHost       = "host"
+	ScopeDomain     = "domain"
+	ScopeSubdomains = "subdomains"
+	ScopePrefix     = "prefix"
+	ScopeAllowlist  = "allowlist"
+	ScopeAny        = "any"
+)
+
+// ValidScope reports whether scope is a supported crawl scope
+func ValidScope(scope string) bool {
+	switch scope {
+	case "", ScopeHost, ScopeDomain, ScopeSubdomains, ScopePrefix, ScopeAllowlist, ScopeAny:
+		return true
+	}
+	return false
+}
+
+func (crawler *Crawler) scope() string {
+	if crawler.config.Option.Scope != "" {
+		return crawler.config.Option.Scope
+	}
+	if crawler.config.Option.ExternalWebpages {
+		return ScopeAny
+	}
+	return ScopeHost
+}
+
+func registrableDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// matchHost reports whether host equals pattern, a leading "*." or "." in
+// pattern also matches any subdomain
+func matchHost(host, pattern string) bool {
+	pattern = strings.ToLower(pattern)
+	if strings.HasPrefix(pattern, "*.") {
+		pattern = pattern[1:]
+	}
+	if strings.HasPrefix(pattern, ".") {
+		return host == pattern[1:] || strings.HasSuffix(host, pattern)
+	}
+	return host == pattern
+}
+
+// inScope reports whether webpage u may be followed from a crawl started at seed
+func (crawler *Crawler) inScope(u, seed *url.URL) bool {
+	if seed == nil {
+		seed = u
+	}
+	host, seedHost := strings.ToLower(u.Hostname()), strings.ToLower(seed.Hostname())
+
+	switch crawler.scope() {
+	case ScopeAny:
+		return true
+	case ScopeDomain:
+		return registrableDomain(host) == registrableDomain(seedHost)
+	case ScopeSubdomains:
+		return host == seedHost || strings.HasSuffix(host, "."+seedHost)
+	case ScopePrefix:
+		prefix := seed.EscapedPath()
+		if idx := strings.LastIndexByte(prefix, '/'); idx != -1 {
+			prefix = prefix[:idx+1]
+		}
+		return host == seedHost && strings.HasPrefix(u.EscapedPath(), prefix)
+	case ScopeAllowlist:
+		if host == seedHost {
+			return true
+		}
+		for _, pattern := range crawler.config.Option.AllowedHosts {
+			if matchHost(host, pattern) {
+				return true
+			}
+		}
+		return false
+	default:
+		return host == seedHost
+	}
+}
@@ -0,0 +1,157 @@
+package crawl
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxSitemapSize  = 50 * 1024 * 1024
+	maxSitemapNests = 5
+
+	defaultSitemapPriority = 0.5
+)
+
+var lastModLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+type sitemapEntry struct {
+	Loc      string `xml:"loc"`
+	LastMod  string `xml:"lastmod"`
+	Priority string `xml:"priority"`
+}
+
+type sitemapDoc struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+func parseLastMod(lastmod string) (time.Time, bool) {
+	lastmod = strings.TrimSpace(lastmod)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, lastmod); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Sitemaps discovers the sitemaps of the host of seed, through robots.txt
+// and /sitemap.xml, and returns the in-scope URLs listed in them scored by their priority
+func (crawler *Crawler) Sitemaps(seed *url.URL) []*URLTopological {
+	var since time.Time
+	if crawler.config.Option.SitemapSince != "" {
+		t, ok := parseLastMod(crawler.config.Option.SitemapSince)
+		if !ok {
+			crawler.Logger.Printf("Invalid sitemapSince value %q, ignored\n", crawler.config.Option.SitemapSince)
+		}
+		since = t
+	}
+
+	root := &url.URL{Scheme: seed.Scheme, Host: seed.Host}
+	locations := crawler.robotsFor(seed).sitemaps
+	locations = append(locations, root.String()+"/sitemap.xml")
+
+	var (
+		urls    []*URLTopological
+		visited = make(map[string]bool)
+	)
+
+	var walk func(loc string, nest int)
+	walk = func(loc string, nest int) {
+		if visited[loc] || nest > maxSitemapNests {
+			return
+		}
+		visited[loc] = true
+
+		doc, err := crawler.fetchSitemap(loc)
+		if err != nil {
+			crawler.Logger.Printf("URL: %s, sitemap error: %v\n", loc, err)
+			return
+		}
+
+		for _, entry := range doc.Sitemaps {
+			if !since.IsZero() {
+				if t, ok := parseLastMod(entry.LastMod); ok && t.Before(since) {
+					continue
+				}
+			}
+			walk(strings.TrimSpace(entry.Loc), nest+1)
+		}
+
+		for _, entry := range doc.URLs {
+			if !since.IsZero() {
+				if t, ok := parseLastMod(entry.LastMod); ok && t.Before(since) {
+					continue
+				}
+			}
+			u, err := url.Parse(strings.TrimSpace(entry.Loc))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			if !crawler.inScope(u, seed) {
+				continue
+			}
+			if rule, ok := crawler.rejected(u, TargetPage); ok {
+				crawler.Logger.Printf("URL: %s, rejected by filter %q\n", u.String(), rule)
+				continue
+			}
+			score, err := strconv.ParseFloat(strings.TrimSpace(entry.Priority), 64)
+			if err != nil {
+				score = defaultSitemapPriority
+			}
+			urls = append(urls, &URLTopological{URL: u, Seed: seed, Score: score})
+		}
+	}
+
+	for _, loc := range locations {
+		walk(loc, 0)
+	}
+	return urls
+}
+
+func (crawler *Crawler) fetchSitemap(loc string) (*sitemapDoc, error) {
+	req, err := createRequest(http.MethodGet, loc, crawler.config.UserAgent, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := crawler.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("status text: " + http.StatusText(resp.StatusCode))
+	}
+
+	// gzipped sitemaps are usually served as application/x-gzip without Content-Encoding
+	var rd io.Reader = bufio.NewReader(io.LimitReader(resp.Body, maxSitemapSize))
+	if magic, err := rd.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(rd)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		rd = io.LimitReader(zr, maxSitemapSize)
+	}
+
+	var doc sitemapDoc
+	if err := xml.NewDecoder(rd).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
@@ -0,0 +1,143 @@
+package crawl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/NzKSO/murphy/conf"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ValidTLSVersion reports whether version is a supported minimum TLS version
+func ValidTLSVersion(version string) bool {
+	_, ok := tlsVersions[version]
+	return ok || version == ""
+}
+
+func tlsVersionName(version uint16) string {
+	for name, v := range tlsVersions {
+		if v == version {
+			return "TLS " + name
+		}
+	}
+	return "unknown"
+}
+
+// certTransport is the transport presenting a client certificate to the hosts matching host
+type certTransport struct {
+	host      string
+	transport *http.Transport
+}
+
+// hostTransport sends requests through the transport of the first client
+// certificate matching their host, or through the default transport
+type hostTransport struct {
+	def   *http.Transport
+	certs []*certTransport
+}
+
+func (ht *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	for _, ct := range ht.certs {
+		if matchHost(host, ct.host) {
+			return ct.transport.RoundTrip(req)
+		}
+	}
+	return ht.def.RoundTrip(req)
+}
+
+func loadCertPool(files []string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no PEM certificate found in " + file)
+		}
+	}
+	return pool, nil
+}
+
+// SetTLS applies the CA bundles, client certificates, minimum version and
+// verification setting of tlsConf to the transports of crawler
+func (crawler *Crawler) SetTLS(tlsConf *conf.TLS) error {
+	if tlsConf == nil {
+		return nil
+	}
+	if !ValidTLSVersion(tlsConf.MinVersion) {
+		return errors.New("invalid minimum TLS version: " + tlsConf.MinVersion)
+	}
+
+	config := &tls.Config{
+		MinVersion:         tlsVersions[tlsConf.MinVersion],
+		InsecureSkipVerify: tlsConf.Insecure,
+	}
+	if len(tlsConf.CAFiles) > 0 {
+		pool, err := loadCertPool(tlsConf.CAFiles)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = pool
+	}
+	if tlsConf.Insecure {
+		crawler.Logger.Println("TLS certificate verification is disabled, connections are open to interception")
+	}
+	crawler.transport.TLSClientConfig = config
+
+	ht := &hostTransport{def: crawler.transport}
+	for _, cc := range tlsConf.ClientCerts {
+		if cc.Host == "" {
+			return errors.New("client certificate requires a host")
+		}
+		cert, err := tls.LoadX509KeyPair(cc.CertFile, cc.KeyFile)
+		if err != nil {
+			return err
+		}
+
+		transport := crawler.transport.Clone()
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		ht.certs = append(ht.certs, &certTransport{host: cc.Host, transport: transport})
+	}
+
+	crawler.certs = ht.certs
+	if len(ht.certs) > 0 {
+		crawler.client.Transport = ht
+	}
+	return nil
+}
+
+// logTLS logs the TLS parameters negotiated with the host of resp once per host
+func (crawler *Crawler) logTLS(resp *http.Response) {
+	if resp.TLS == nil {
+		return
+	}
+	host := resp.Request.URL.Host
+	if _, loaded := crawler.tlsHosts.LoadOrStore(host, true); loaded {
+		return
+	}
+
+	state := resp.TLS
+	var peer string
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		peer = ", certificate: " + cert.Subject.CommonName + " issued by " + cert.Issuer.CommonName
+	}
+	crawler.Logger.Printf("TLS: host %s, %s, cipher suite %s%s\n",
+		host, tlsVersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), peer)
+}
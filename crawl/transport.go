@@ -0,0 +1,83 @@
+package crawl
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/NzKSO/murphy/conf"
+)
+
+// Default timeouts in seconds and limits of requests
+const (
+	defaultConnectTimeout        = 30
+	defaultTLSHandshakeTimeout   = 10
+	defaultResponseHeaderTimeout = 30
+	defaultIdleTimeout           = 90
+	defaultMaxRedirects          = 10
+)
+
+var (
+	errBodyTooLarge   = errors.New("response body exceeds the maximum body size")
+	errRedirectPolicy = errors.New("redirect refused by policy")
+)
+
+func seconds(n, def int) time.Duration {
+	if n == 0 {
+		n = def
+	}
+	return time.Duration(n) * time.Second
+}
+
+// newTransport returns a transport with the timeouts of option
+func newTransport(option *conf.Option) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   seconds(option.ConnectTimeout, defaultConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   seconds(option.TLSHandshakeTimeout, defaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: seconds(option.ResponseHeaderTimeout, defaultResponseHeaderTimeout),
+		IdleConnTimeout:       seconds(option.IdleTimeout, defaultIdleTimeout),
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// limitedBody fails reads beyond max bytes of a response body
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	if lb.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > lb.remaining+1 {
+		p = p[:lb.remaining+1]
+	}
+	n, err := lb.ReadCloser.Read(p)
+	lb.remaining -= int64(n)
+	if lb.remaining < 0 {
+		return n + int(lb.remaining), errBodyTooLarge
+	}
+	return n, err
+}
+
+// limitBody caps the size of the body of resp to the maximum body size
+func (crawler *Crawler) limitBody(resp *http.Response) error {
+	max := crawler.config.Option.MaxBodySize
+	if max <= 0 {
+		return nil
+	}
+	if resp.ContentLength > max {
+		resp.Body.Close()
+		return errBodyTooLarge
+	}
+	resp.Body = &limitedBody{resp.Body, max}
+	return nil
+}
@@ -18,19 +18,54 @@ import (
 
 const characterSet = "_-9876543210ABCDEFGHIJKMNLOPQRSTUVWXYZzyxwvutsrqpolnmkjihgfedcba"
 
-func writeFile(rd io.Reader, dir, filename string) error {
-	data, err := ioutil.ReadAll(rd)
+var errFileTooLarge = errors.New("file exceeds the maximum size")
+
+// writeFile streams rd to a temporary file in dir which is renamed to filename
+// once fully written and synced, the temporary file is removed on failure
+func (crawler *Crawler) writeFile(rd io.Reader, dir, filename string) error {
+	tmp, err := ioutil.TempFile(dir, "."+filename+".*.tmp")
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(filepath.Join(dir, filename), data, 0755)
+
+	maxBytes := crawler.config.Option.MaxFileSize
+	if maxBytes > 0 {
+		rd = io.LimitReader(rd, maxBytes+1)
+	}
+
+	n, err := io.Copy(tmp, rd)
+	if err == nil && maxBytes > 0 && n > maxBytes {
+		err = errFileTooLarge
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0755)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, filename))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// tooLarge reports whether the announced length of resp exceeds the maximum file size
+func (crawler *Crawler) tooLarge(resp *http.Response) bool {
+	maxBytes := crawler.config.Option.MaxFileSize
+	return maxBytes > 0 && resp.ContentLength > maxBytes
 }
 
 func getFileName(path, ext string) string {
 	var fileName string
 	base := filepath.Base(path)
 	if base != "." && base != string(filepath.Separator) && base != string(filepath.ListSeparator) {
-		if idx := strings.Index(base, ext); idx != -1 {
+		if idx := strings.Index(base, ext); ext != "" && idx != -1 {
 			fileName = base[:idx+len(ext)]
 		} else {
 			fileName = base + ext
@@ -110,7 +145,7 @@ func createRequest(method, url, userAgent string, body io.Reader) (*http.Request
 	}
 
 	req.Header.Set("Accept-Charset", "utf-8")
-	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	req.Header.Set("Accept-Encoding", acceptEncoding)
 	req.Header.Set("User-Agent", userAgent)
 
 	return req, nil
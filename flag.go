@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/NzKSO/murphy/conf"
+	"github.com/NzKSO/murphy/crawl"
 )
 
 var (
@@ -19,10 +22,54 @@ var (
 	ftypes        fileExts
 	showVersion   bool
 	disableCookie bool
+	resume        bool
+	hostRate      float64
+	hostDelay     int
+	hostMaxCon    int
+	ignoreRobots  bool
+	sitemaps      bool
+	order         string
+	grace         int
+	retries       int
+	retryBackoff  int
+	filters       []conf.Filter
+	scope         string
+	allowedHosts  hostList
+	maxFileSize   int64
+	segments      int
+	segThreshold  int64
+	cookiesIn     string
+	cookiesOut    string
+	rotation      string
+	connectTO     int
+	tlsTO         int
+	headerTO      int
+	idleTO        int
+	timeout       int
+	maxRedirects  int
+	maxBodySize   int64
+	caFiles       pathList
+	tlsMinVersion string
+	insecure      bool
+	pacFile       string
+	redirects     string
+	srcset        string
 )
 
 type fileExts []string
 
+type hostList []string
+
+type pathList []string
+
+// filterFlag appends the rules given on command line to filters in order,
+// a value is a regex matching the full URL unless prefixed by glob:, path: or pathGlob:
+type filterFlag struct {
+	name   string
+	action string
+	target string
+}
+
 func (mt *fileExts) String() string {
 	return fmt.Sprintf("%s", *mt)
 }
@@ -39,6 +86,63 @@ func (mt *fileExts) Set(value string) error {
 	return nil
 }
 
+func (hl *hostList) String() string {
+	return strings.Join(*hl, ",")
+}
+
+func (hl *hostList) Set(value string) error {
+	for _, host := range strings.Split(value, ",") {
+		if host != "" {
+			*hl = append(*hl, host)
+		}
+	}
+	if len(*hl) == 0 {
+		return errors.New("empty flag value")
+	}
+	return nil
+}
+
+func (pl *pathList) String() string {
+	return strings.Join(*pl, ",")
+}
+
+func (pl *pathList) Set(value string) error {
+	if value == "" {
+		return errors.New("empty flag value")
+	}
+	*pl = append(*pl, value)
+	return nil
+}
+
+func (ff *filterFlag) String() string {
+	return ""
+}
+
+func (ff *filterFlag) Set(value string) error {
+	f := conf.Filter{
+		Name:   "-" + ff.name + " " + value,
+		Action: ff.action,
+		Target: ff.target,
+	}
+
+	switch {
+	case strings.HasPrefix(value, "glob:"):
+		f.Glob = value[len("glob:"):]
+	case strings.HasPrefix(value, "pathGlob:"):
+		f.Glob, f.Path = value[len("pathGlob:"):], true
+	case strings.HasPrefix(value, "path:"):
+		f.Regex, f.Path = value[len("path:"):], true
+	default:
+		f.Regex = value
+	}
+
+	if f.Regex == "" && f.Glob == "" {
+		return errors.New("empty flag value")
+	}
+	filters = append(filters, f)
+	return nil
+}
+
 func init() {
 	flag.BoolVar(&showVersion, "version", false, versionUsage)
 	flag.StringVar(&configFile, "config", "", configUsage)
@@ -51,6 +155,41 @@ func init() {
 	flag.Var(&ftypes, "ftypes", listUsage)
 	flag.BoolVar(&headlessMode, "headless", false, headlessUsage)
 	flag.BoolVar(&disableCookie, "disableCookie", false, cookieUsage)
+	flag.BoolVar(&resume, "resume", false, resumeUsage)
+	flag.Float64Var(&hostRate, "hostRate", 0, hostRateUsage)
+	flag.IntVar(&hostDelay, "hostDelay", 0, hostDelayUsage)
+	flag.IntVar(&hostMaxCon, "hostMaxCon", 0, hostMaxConUsage)
+	flag.BoolVar(&ignoreRobots, "ignoreRobots", false, ignoreRobotsUsage)
+	flag.BoolVar(&sitemaps, "sitemaps", false, sitemapsUsage)
+	flag.StringVar(&order, "order", "", orderUsage)
+	flag.IntVar(&grace, "grace", 0, graceUsage)
+	flag.IntVar(&retries, "retries", 0, retriesUsage)
+	flag.IntVar(&retryBackoff, "retryBackoff", 0, retryBackoffUsage)
+	flag.Var(&filterFlag{"allow", crawl.ActionAllow, crawl.TargetPage}, "allow", allowUsage)
+	flag.Var(&filterFlag{"deny", crawl.ActionDeny, crawl.TargetPage}, "deny", denyUsage)
+	flag.Var(&filterFlag{"allowAsset", crawl.ActionAllow, crawl.TargetAsset}, "allowAsset", allowAssetUsage)
+	flag.Var(&filterFlag{"denyAsset", crawl.ActionDeny, crawl.TargetAsset}, "denyAsset", denyAssetUsage)
+	flag.StringVar(&scope, "scope", "", scopeUsage)
+	flag.Var(&allowedHosts, "allowHost", allowHostUsage)
+	flag.Int64Var(&maxFileSize, "maxFileSize", 0, maxFileSizeUsage)
+	flag.IntVar(&segments, "segments", 0, segmentsUsage)
+	flag.Int64Var(&segThreshold, "segmentThreshold", 0, segmentThresholdUsage)
+	flag.StringVar(&cookiesIn, "cookies-in", "", cookiesInUsage)
+	flag.StringVar(&cookiesOut, "cookies-out", "", cookiesOutUsage)
+	flag.StringVar(&rotation, "rotation", "", rotationUsage)
+	flag.IntVar(&connectTO, "connectTimeout", 0, connectTimeoutUsage)
+	flag.IntVar(&tlsTO, "tlsHandshakeTimeout", 0, tlsHandshakeTimeoutUsage)
+	flag.IntVar(&headerTO, "responseHeaderTimeout", 0, responseHeaderTimeoutUsage)
+	flag.IntVar(&idleTO, "idleTimeout", 0, idleTimeoutUsage)
+	flag.IntVar(&timeout, "timeout", 0, timeoutUsage)
+	flag.IntVar(&maxRedirects, "maxRedirects", 0, maxRedirectsUsage)
+	flag.Int64Var(&maxBodySize, "maxBodySize", 0, maxBodySizeUsage)
+	flag.Var(&caFiles, "caFile", caFileUsage)
+	flag.StringVar(&tlsMinVersion, "tlsMinVersion", "", tlsMinVersionUsage)
+	flag.BoolVar(&insecure, "insecure", false, insecureUsage)
+	flag.StringVar(&pacFile, "pac", "", pacUsage)
+	flag.StringVar(&redirects, "redirects", "", redirectsUsage)
+	flag.StringVar(&srcset, "srcset", "", srcsetUsage)
 
 	flag.Usage = func() {
 		progName := strings.TrimPrefix(os.Args[0], "./")
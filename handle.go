@@ -10,7 +10,9 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"syscall"
+	"time"
 
 	"github.com/NzKSO/murphy/conf"
 	"github.com/NzKSO/murphy/crawl"
@@ -25,7 +27,7 @@ func handleFlag() {
 		os.Exit(0)
 	}
 
-	if flag.NArg() < 1 || flag.NFlag() < 1 {
+	if (flag.NArg() < 1 && !resume) || flag.NFlag() < 1 {
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -60,8 +62,16 @@ func start() {
 		log.Fatalln(err)
 	}
 
+	if err := crawler.Login(); err != nil {
+		log.Fatalln(err)
+	}
+
+	var server *headless.Server
 	if config.Headless.Enable {
-		server := headless.New()
+		server = headless.New()
+		if pac := crawler.ProxyPAC(); pac != "" {
+			server.SetProxyPAC(pac)
+		}
 		if err := server.Start(); err != nil {
 			log.Fatalln(err)
 		}
@@ -72,9 +82,19 @@ func start() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
-	crawler.URLTopoCh = make(chan *crawl.URLTopological, 10)
-
+	crawler.Frontier.Hold()
 	go func() {
+		defer crawler.Frontier.Release()
+
+		if config.Option.Resume {
+			pending := crawler.Restore()
+			crawler.Logger.Printf("Resuming crawl with %d pending url(s)\n", len(pending))
+			for _, urlTopo := range pending {
+				crawler.Frontier.Push(urlTopo)
+			}
+		}
+
+		var seeds []*url.URL
 		for _, rawurl := range flag.Args() {
 			u, err := url.ParseRequestURI(rawurl)
 			if err != nil {
@@ -82,25 +102,133 @@ func start() {
 			} else if u.Scheme != "http" && u.Scheme != "https" {
 				log.Fatalln(invalidURL)
 			}
-			crawler.URLTopoCh <- &crawl.URLTopological{URL: u, Depth: config.Option.Depth}
+			seeds = append(seeds, u)
+		}
+
+		// seeds take precedence over sitemap entries whose priority ranges from 0.0 to 1.0
+		for _, u := range seeds {
+			crawler.Enqueue(&crawl.URLTopological{URL: u, Seed: u, Depth: config.Option.Depth, Score: 1})
+		}
+
+		if config.Option.Sitemaps {
+			for _, seed := range seeds {
+				for _, urlTopo := range crawler.Sitemaps(seed) {
+					urlTopo.Depth = config.Option.Depth
+					crawler.Enqueue(urlTopo)
+				}
+			}
 		}
 	}()
 
-loop:
-	for {
-		select {
-		case <-sigCh:
-			break loop
-		case urlTopo, ok := <-crawler.URLTopoCh:
-			if !ok {
-				break loop
+	interval := config.Option.CheckpointInterval
+	if interval == 0 {
+		interval = defaultCheckpointInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	defer crawler.Checkpoint.Close()
+
+	grace := time.Duration(config.Option.GracePeriod) * time.Second
+	if grace == 0 {
+		grace = defaultGracePeriod * time.Second
+	}
+
+	go func() {
+		var stopping bool
+		for {
+			select {
+			case <-sigCh:
+				if stopping {
+					crawler.Logger.Println("Forced exit")
+					crawler.Checkpoint.Close()
+					crawler.Cache.Save()
+					server.Stop()
+					os.Exit(1)
+				}
+				stopping = true
+				crawler.Logger.Printf("Shutting down, waiting up to %v for in-flight downloads, send the signal again to force exit\n", grace)
+				crawler.Frontier.Close()
+			case <-ticker.C:
+				if err := crawler.Checkpoint.Save(); err != nil {
+					crawler.Logger.Printf("Error saving checkpoint: %v\n", err)
+				}
+				if err := crawler.Cache.Save(); err != nil {
+					crawler.Logger.Printf("Error saving cache: %v\n", err)
+				}
 			}
+		}
+	}()
 
+	for {
+		urlTopo, ok := crawler.Frontier.Pop()
+		if !ok {
+			break
+		}
+
+		if crawler.Semaphore != nil {
+			crawler.Semaphore <- true
+		}
+
+		// the crawl may have been stopped while waiting for the semaphore
+		if crawler.Frontier.Closed() || crawler.Aborted() {
 			if crawler.Semaphore != nil {
-				crawler.Semaphore <- true
+				<-crawler.Semaphore
 			}
+			crawler.Frontier.Requeue(urlTopo)
+			break
+		}
+
+		crawler.Dispatch(urlTopo)
+	}
+
+	if !crawler.Wait(grace) {
+		crawler.Logger.Printf("Grace period of %v elapsed, aborting in-flight downloads\n", grace)
+		crawler.Abort()
+		crawler.Wait(0)
+	}
+
+	if err := crawler.Cache.Save(); err != nil {
+		crawler.Logger.Printf("Error saving cache: %v\n", err)
+	}
+
+	if err := crawler.CloseCaptures(); err != nil {
+		crawler.Logger.Printf("Error closing captures: %v\n", err)
+	}
 
-			go crawler.Crawl(urlTopo)
+	if config.CookiesOut != "" {
+		if err := crawler.SaveCookies(config.CookiesOut); err != nil {
+			crawler.Logger.Printf("Error saving cookies: %v\n", err)
+		}
+	}
+
+	if retried := crawler.Retried(); len(retried) > 0 {
+		urls := make([]string, 0, len(retried))
+		for rawurl := range retried {
+			urls = append(urls, rawurl)
+		}
+		sort.Strings(urls)
+
+		crawler.Logger.Printf("%d url(s) retried:\n", len(urls))
+		for _, rawurl := range urls {
+			crawler.Logger.Printf("%s (%d attempts)\n", rawurl, retried[rawurl])
+		}
+	}
+
+	if stats := crawler.ProxyStats(); len(stats) > 0 {
+		crawler.Logger.Printf("%d proxies in the pool:\n", len(stats))
+		for _, stat := range stats {
+			var evicted string
+			if stat.Evicted {
+				evicted = ", evicted"
+			}
+			crawler.Logger.Printf("%s (%d requests, %d failures%s)\n", stat.URL, stat.Requests, stat.Failures, evicted)
+		}
+	}
+
+	if unfinished := crawler.Unfinished(); len(unfinished) > 0 {
+		crawler.Logger.Printf("%d url(s) left unfinished, use -resume to continue:\n", len(unfinished))
+		for _, rawurl := range unfinished {
+			crawler.Logger.Println(rawurl)
 		}
 	}
 }
@@ -112,6 +240,20 @@ func newCrawler(config *conf.Configuration) (*crawl.Crawler, error) {
 		crawler.Semaphore = make(chan bool, config.Option.MaxConcurrency)
 	}
 
+	if err := crawler.SetFilters(config.Filters); err != nil {
+		return nil, err
+	}
+
+	if err := crawler.SetAuth(config.Auth); err != nil {
+		return nil, err
+	}
+
+	frontier, err := crawl.NewFrontier(config.Option.Order)
+	if err != nil {
+		return nil, err
+	}
+	crawler.Frontier = frontier
+
 	if _, ok := crawl.MatchMIMEInExts("text/html", config.FileTypes); ok {
 		crawler.DownloadHTML = true
 	}
@@ -124,6 +266,22 @@ func newCrawler(config *conf.Configuration) (*crawl.Crawler, error) {
 		return nil, err
 	}
 
+	if err := crawler.SetExtractRules(config.Extract); err != nil {
+		return nil, err
+	}
+
+	checkpoint, err := crawl.OpenCheckpoint(config.Dir, config.Option.Resume)
+	if err != nil {
+		return nil, err
+	}
+	crawler.Checkpoint = checkpoint
+
+	cache, err := crawl.OpenCache(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	crawler.Cache = cache
+
 	if config.Log != "" {
 		if err := os.MkdirAll(filepath.Dir(config.Log), 0755); err != nil {
 			return nil, err
@@ -144,11 +302,39 @@ func newCrawler(config *conf.Configuration) (*crawl.Crawler, error) {
 		crawler.EnableCookie()
 	}
 
+	if config.CookiesIn != "" {
+		if err := crawler.LoadCookies(config.CookiesIn); err != nil {
+			return nil, err
+		}
+	}
+
+	proxies := config.Proxies
 	if config.Proxy != nil {
-		crawler.SetProxy(http.ProxyURL(config.Proxy.URL()))
+		proxies = append([]conf.Proxy{*config.Proxy}, proxies...)
+	}
+	if len(proxies) > 0 {
+		if err := crawler.SetProxies(proxies, config.ProxyPool); err != nil {
+			return nil, err
+		}
 	} else {
 		crawler.SetProxy(http.ProxyFromEnvironment)
 	}
 
+	if err := crawler.SetProxyRules(config.ProxyRules, config.PAC); err != nil {
+		return nil, err
+	}
+
+	if err := crawler.SetTLS(config.TLS); err != nil {
+		return nil, err
+	}
+
+	if config.Option.Timeout > 0 {
+		crawler.SetTimeout(time.Duration(config.Option.Timeout) * time.Second)
+	}
+
+	if err := crawler.SetLogin(config.Login); err != nil {
+		return nil, err
+	}
+
 	return crawler, nil
 }
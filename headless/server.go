@@ -2,6 +2,7 @@ package headless
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net"
@@ -36,6 +37,12 @@ func New() *Server {
 	}
 }
 
+// SetProxyPAC makes Chrome pick proxies with the PAC script, it must be called before Start
+func (ser *Server) SetProxyPAC(script string) {
+	ser.args = append(ser.args, "--proxy-pac-url=data:application/x-ns-proxy-autoconfig;base64,"+
+		base64.StdEncoding.EncodeToString([]byte(script)))
+}
+
 func getFreePort() (int, error) {
 	listener, err := net.Listen("tcp", ":0")
 	if err != nil {